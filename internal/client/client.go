@@ -1,8 +1,14 @@
 package client
 
 import (
+	"bufio"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/urfave/cli"
 
@@ -14,6 +20,7 @@ type config struct {
 	Server  server.Config   `json:"server"`
 	Backend string          `json:"backend"`
 	Storage json.RawMessage `json:"storage"`
+	Hashes  key.HashConfig  `json:"hashes"`
 }
 
 func loadConfig(c *cli.Context) (*config, error) {
@@ -35,3 +42,82 @@ func loadConfig(c *cli.Context) (*config, error) {
 func getStorage(c config) (key.Storage, error) {
 	return key.Open(c.Backend, c.Storage)
 }
+
+// Exit codes for errors of the key package. Any other error exits with 1.
+const (
+	exitNotFound             = 2
+	exitInvalidID            = 3
+	exitUnsupportedAlgorithm = 4
+	exitDecrypt              = 5
+	exitSealed               = 6
+	exitKeyUnusable          = 7
+	exitUsageNotAllowed      = 8
+)
+
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{key.ErrNotFound, exitNotFound},
+	{key.ErrInvalidID, exitInvalidID},
+	{key.ErrUnsupportedAlgorithm, exitUnsupportedAlgorithm},
+	{key.ErrSealed, exitSealed},
+	{key.ErrDisabled, exitKeyUnusable},
+	{key.ErrCompromised, exitKeyUnusable},
+	{key.ErrNotYetValid, exitKeyUnusable},
+	{key.ErrExpired, exitKeyUnusable},
+	{key.ErrSignatureLimit, exitKeyUnusable},
+	{key.ErrUsageNotAllowed, exitUsageNotAllowed},
+	{key.ErrPendingDeletion, exitKeyUnusable},
+	{key.ErrDestroyed, exitKeyUnusable},
+	{key.ErrKeyMismatch, exitDecrypt},
+	{key.ErrDecrypt, exitDecrypt},
+}
+
+// exitError wraps errors of the key package with their exit code.
+func exitError(err error) error {
+	for _, e := range exitCodes {
+		if errors.Is(err, e.err) {
+			return cli.NewExitError(err.Error(), e.code)
+		}
+	}
+	return err
+}
+
+// unsealStorage prompts for shares on the terminal until s is unsealed. The terminal is used
+// rather than stdin, which may carry a message to sign.
+func unsealStorage(s key.Sealer) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("%w: shares can only be entered on a terminal: %v", key.ErrSealed, err)
+	}
+	defer tty.Close()
+
+	r := bufio.NewReader(tty)
+	status := s.SealStatus()
+	for status.Sealed {
+		share, err := readShare(r, tty, fmt.Sprintf("Share %d of %d: ", status.Progress+1, status.Threshold))
+		if err != nil {
+			return fmt.Errorf("%w: %v", key.ErrSealed, err)
+		}
+		if status, err = s.Unseal(share); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readShare prompts for a hex encoded share on w and reads it from r. Shares are never taken as
+// flags, which would leave them in the shell history and the process list.
+func readShare(r *bufio.Reader, w io.Writer, prompt string) ([]byte, error) {
+	fmt.Fprint(w, prompt)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("could not read share: %v", err)
+	}
+	share, err := hex.DecodeString(strings.TrimSpace(line))
+	if err != nil {
+		return nil, fmt.Errorf("share must be hex encoded: %v", err)
+	}
+	return share, nil
+}
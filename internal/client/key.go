@@ -1,21 +1,26 @@
 package client
 
 import (
+	"context"
 	"crypto"
 	"crypto/rand"
+	"crypto/rsa"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"text/tabwriter"
+	"time"
 
 	"github.com/urfave/cli"
 
 	"github.com/belljustin/hancock/key"
 )
 
-var hashes = map[string]crypto.Hash{
-	"sha256": crypto.SHA256,
-}
-
 // KeyCmd is the command for managing keys
 var KeyCmd = cli.Command{
 	Name:  "key",
@@ -23,11 +28,21 @@ var KeyCmd = cli.Command{
 	Subcommands: []cli.Command{
 		createKeyCmd,
 		getKeyCmd,
+		listKeysCmd,
 		signCmd,
+		rotateKeyCmd,
+		setKeyStateCmd("enable", key.Enabled, "enable a disabled key"),
+		setKeyStateCmd("disable", key.Disabled, "disable a key, so that it can't sign until it is enabled"),
+		setKeyStateCmd("compromise", key.Compromised, "mark a key compromised, so that it can never sign again"),
+		deleteKeyCmd,
+		restoreKeyCmd,
+		purgeKeysCmd,
+		reencodeCmd,
+		rewrapCmd,
 	},
 }
 
-type clientFunc func(key.Storage, *cli.Context) error
+type clientFunc func(*config, key.Storage, *cli.Context) error
 
 func createClientFunc(f clientFunc) cli.ActionFunc {
 	return func(c *cli.Context) error {
@@ -38,10 +53,21 @@ func createClientFunc(f clientFunc) cli.ActionFunc {
 
 		storage, err := key.Open(conf.Backend, conf.Storage)
 		if err != nil {
-			return err
+			return exitError(err)
 		}
 
-		return f(storage, c)
+		defer storage.Close()
+
+		// Storage opened by the CLI starts sealed, like the server. It is unsealed on demand, so
+		// that commands which don't decrypt keys don't ask for shares.
+		err = f(conf, storage, c)
+		if sealer, ok := storage.(key.Sealer); ok && errors.Is(err, key.ErrSealed) && sealer.SealStatus().Sealed {
+			if err := unsealStorage(sealer); err != nil {
+				return exitError(err)
+			}
+			err = f(conf, storage, c)
+		}
+		return exitError(err)
 	}
 }
 
@@ -54,17 +80,102 @@ var createKeyCmd = cli.Command{
 			Name:  "alg",
 			Usage: "the algorithm to use in key generation",
 		},
+		cli.StringFlag{
+			Name:  "curve",
+			Usage: "the elliptic curve to use for ecdsa keys (P-256, P-384 or P-521)",
+		},
+		cli.StringSliceFlag{
+			Name:  "opt",
+			Usage: "a name=value option of the algorithm, such as bits=4096 for rsa keys, which may be repeated",
+		},
+		cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "a name=value label of the key, which may be repeated",
+		},
+		cli.StringFlag{
+			Name:  "description",
+			Usage: "a description of the key",
+		},
+		cli.StringFlag{
+			Name:  "creator",
+			Usage: "who created the key (default: the current user)",
+		},
+		cli.DurationFlag{
+			Name:  "rotation-period",
+			Usage: "rotate the key automatically after the period, such as 720h",
+		},
+		cli.StringFlag{
+			Name:  "not-before",
+			Usage: "the RFC 3339 time from which the key can sign",
+		},
+		cli.StringFlag{
+			Name:  "not-after",
+			Usage: "the RFC 3339 time after which the key can no longer sign",
+		},
+		cli.StringSliceFlag{
+			Name:  "allowed-hash",
+			Usage: "a hash the key may sign digests of, which may be repeated (default: any)",
+		},
+		cli.StringSliceFlag{
+			Name:  "allowed-padding",
+			Usage: "an rsa padding scheme the key may sign with, which may be repeated (default: any)",
+		},
+		cli.Int64Flag{
+			Name:  "max-signatures",
+			Usage: "the number of signatures after which the key can no longer sign (default: unlimited)",
+		},
 	},
 }
 
-func createKey(s key.Storage, c *cli.Context) error {
+func createKey(_ *config, s key.Storage, c *cli.Context) error {
 	alg := c.String("alg")
 	if alg == "" {
 		return errors.New("alg must not be empty")
 	}
 
-	opts := key.Opts{}
-	k, err := s.Create(alg, opts)
+	opts, err := key.ParseOpts(c.StringSlice("opt"))
+	if err != nil {
+		return err
+	}
+	if curve := c.String("curve"); curve != "" {
+		opts["curve"] = curve
+	}
+	labels, err := key.ParseLabels(c.StringSlice("label"))
+	if err != nil {
+		return err
+	}
+	creator := c.String("creator")
+	if creator == "" {
+		if u, err := user.Current(); err == nil {
+			creator = u.Username
+		}
+	}
+
+	m := key.Metadata{
+		Labels:          labels,
+		Description:     c.String("description"),
+		Creator:         creator,
+		RotationPeriod:  key.Duration(c.Duration("rotation-period")),
+		AllowedHashes:   c.StringSlice("allowed-hash"),
+		AllowedPaddings: c.StringSlice("allowed-padding"),
+		MaxSignatures:   c.Int64("max-signatures"),
+	}
+	if notBefore := c.String("not-before"); notBefore != "" {
+		t, err := time.Parse(time.RFC3339, notBefore)
+		if err != nil {
+			return err
+		}
+		m.NotBefore = &t
+	}
+	if notAfter := c.String("not-after"); notAfter != "" {
+		t, err := time.Parse(time.RFC3339, notAfter)
+		if err != nil {
+			return err
+		}
+		m.NotAfter = &t
+	}
+
+	k, err := s.CreateContext(context.Background(), alg, opts, m)
 	if err != nil {
 		return err
 	}
@@ -84,7 +195,7 @@ var getKeyCmd = cli.Command{
 	},
 }
 
-func getKey(s key.Storage, c *cli.Context) error {
+func getKey(_ *config, s key.Storage, c *cli.Context) error {
 	id := c.String("id")
 	if id == "" {
 		return errors.New("id must not be empty")
@@ -96,12 +207,129 @@ func getKey(s key.Storage, c *cli.Context) error {
 	}
 
 	fmt.Printf("%+v\n", k.Signer.Public())
+	fmt.Printf("State: %s\n", k.GetState())
+	if k.MaxSignatures > 0 {
+		fmt.Printf("Signatures: %d of %d\n", k.SignatureCount, k.MaxSignatures)
+	}
+	if k.NotBefore != nil {
+		fmt.Printf("Not before: %s\n", k.NotBefore.Format(time.RFC3339))
+	}
+	if k.NotAfter != nil {
+		fmt.Printf("Not after: %s\n", k.NotAfter.Format(time.RFC3339))
+	}
+	fmt.Printf("Primary version: %d\n", k.Version)
+	for _, v := range k.Versions {
+		fmt.Printf("Version %d: %+v\n", v.Version, v.Signer.Public())
+	}
 	return nil
 }
 
+var listKeysCmd = cli.Command{
+	Name:   "list",
+	Usage:  "list existing keys in order of creation",
+	Action: createClientFunc(listKeys),
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "alg",
+			Usage: "only list keys of the algorithm",
+		},
+		cli.StringFlag{
+			Name:  "created-since",
+			Usage: "only list keys created at or after the RFC 3339 time",
+		},
+		cli.StringFlag{
+			Name:  "created-before",
+			Usage: "only list keys created before the RFC 3339 time",
+		},
+		cli.DurationFlag{
+			Name:  "expiring-within",
+			Usage: "only list keys which can no longer sign after the period, such as 720h",
+		},
+		cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "only list keys with the name=value label, which may be repeated",
+		},
+		cli.StringFlag{
+			Name:  "cursor",
+			Usage: "continue listing from the cursor of a previous list",
+		},
+		cli.IntFlag{
+			Name:  "limit",
+			Usage: "the maximum number of keys to list",
+			Value: key.DefaultListLimit,
+		},
+		cli.StringFlag{
+			Name:  "output",
+			Usage: "the output format, either table or json",
+			Value: "table",
+		},
+	},
+}
+
+func listKeys(_ *config, s key.Storage, c *cli.Context) error {
+	labels, err := key.ParseLabels(c.StringSlice("label"))
+	if err != nil {
+		return err
+	}
+
+	o := key.ListOptions{
+		Algorithm: c.String("alg"),
+		Labels:    labels,
+		Cursor:    c.String("cursor"),
+		Limit:     c.Int("limit"),
+	}
+
+	if since := c.String("created-since"); since != "" {
+		if o.CreatedSince, err = time.Parse(time.RFC3339, since); err != nil {
+			return err
+		}
+	}
+	if before := c.String("created-before"); before != "" {
+		if o.CreatedBefore, err = time.Parse(time.RFC3339, before); err != nil {
+			return err
+		}
+	}
+
+	if within := c.Duration("expiring-within"); within > 0 {
+		o.ExpiresBefore = time.Now().Add(within)
+	}
+
+	l, err := s.List(context.Background(), o)
+	if err != nil {
+		return err
+	}
+
+	switch c.String("output") {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(l)
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tALG\tSTATE\tCREATED\tNOT AFTER\tLABELS")
+		for _, k := range l.Keys {
+			notAfter := "-"
+			if k.NotAfter != nil {
+				notAfter = k.NotAfter.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Algorithm, k.GetState(),
+				k.CreatedAt.Format(time.RFC3339), notAfter, key.FormatLabels(k.Labels))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if l.NextCursor != "" {
+			fmt.Printf("\nMore keys with --cursor %s\n", l.NextCursor)
+		}
+		return nil
+	default:
+		return fmt.Errorf("output '%s' is not supported", c.String("output"))
+	}
+}
+
 var signCmd = cli.Command{
 	Name:   "sign",
-	Usage:  "sign a digest",
+	Usage:  "sign a digest, or a message read from a file or stdin",
 	Action: createClientFunc(sign),
 	Flags: []cli.Flag{
 		cli.StringFlag{
@@ -114,43 +342,346 @@ var signCmd = cli.Command{
 		},
 		cli.StringFlag{
 			Name:  "hash",
-			Usage: "the hashing algorithm used to create the digest",
+			Usage: "the hashing algorithm used to create the digest, or to hash the file",
 			Value: "sha256",
 		},
+		cli.StringFlag{
+			Name:  "file",
+			Usage: "a file containing the message to be hashed and signed",
+		},
+		cli.BoolFlag{
+			Name:  "stdin",
+			Usage: "read the message to be hashed and signed from stdin",
+		},
+		cli.StringFlag{
+			Name:  "padding",
+			Usage: "the rsa padding scheme, either pkcs1v15 (default) or pss",
+		},
+		cli.IntFlag{
+			Name:  "salt-length",
+			Usage: "the pss salt length, where 0 is the maximum and -1 equals the hash length",
+			Value: rsa.PSSSaltLengthEqualsHash,
+		},
+		cli.BoolFlag{
+			Name:  "low-s",
+			Usage: "normalize secp256k1 signatures to low-S",
+		},
+		cli.BoolFlag{
+			Name:  "recoverable",
+			Usage: "produce a 65 byte r||s||v secp256k1 signature with a public key recovery id",
+		},
+		cli.StringFlag{
+			Name:  "message",
+			Usage: "the hex encoded message to be signed by ed25519 keys",
+		},
 	},
 }
 
-func sign(s key.Storage, c *cli.Context) error {
+func sign(conf *config, s key.Storage, c *cli.Context) error {
 	id := c.String("id")
 	if id == "" {
 		return errors.New("id must not be empty")
 	}
 
+	k, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := k.CheckSign(); err != nil {
+		return err
+	}
+
+	if !k.Pure() {
+		if err := k.CheckUsage(c.String("hash"), c.String("padding")); err != nil {
+			return err
+		}
+	}
+
+	var digest []byte
+	var opts crypto.SignerOpts
+	if c.IsSet("file") || c.Bool("stdin") {
+		digest, opts, err = readFile(conf.Hashes.GetHashes(), k, c)
+	} else if k.Pure() {
+		digest, opts, err = readMessage(k, c)
+	} else {
+		digest, opts, err = readDigest(conf.Hashes.GetHashes(), k, c)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The signature is only counted once the input is known to be valid, and refunded if signing
+	// fails anyway.
+	if err := s.CountSignature(context.Background(), k.ID); err != nil {
+		return err
+	}
+	signature, err := k.Signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		if rerr := s.RefundSignature(context.Background(), k.ID); rerr != nil {
+			return fmt.Errorf("%v (could not refund signature: %v)", err, rerr)
+		}
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Signed with version %d\n", k.Version)
+	fmt.Printf("%v", signature)
+	return nil
+}
+
+// readMessage returns the hex encoded message to be signed by a pure key.
+func readMessage(k *key.Key, c *cli.Context) ([]byte, crypto.SignerOpts, error) {
+	message := c.String("message")
+	if message == "" {
+		return nil, nil, fmt.Errorf("message must not be empty for '%s' keys", k.Algorithm)
+	}
+	bMessage, err := hex.DecodeString(message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts, err := k.SignerOpts(crypto.Hash(0), signParams(c))
+	if err != nil {
+		return nil, nil, err
+	}
+	return bMessage, opts, nil
+}
+
+// readDigest returns the hex encoded digest to be signed and the options to sign it with.
+func readDigest(hashes *key.HashRegistry, k *key.Key, c *cli.Context) ([]byte, crypto.SignerOpts, error) {
 	digest := c.String("digest")
 	if digest == "" {
-		return errors.New("digest must not be empty")
+		return nil, nil, errors.New("digest must not be empty")
 	}
 	bDigest, err := hex.DecodeString(digest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hash, err := hashes.Digest(c.String("hash"), bDigest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts, err := k.SignerOpts(hash, signParams(c))
+	if err != nil {
+		return nil, nil, err
+	}
+	return bDigest, opts, nil
+}
+
+// readFile reads the message to be signed from the file or stdin. Unless the key is pure, the
+// message is streamed through the hash and the resulting digest is returned instead.
+func readFile(hashes *key.HashRegistry, k *key.Key, c *cli.Context) ([]byte, crypto.SignerOpts, error) {
+	var r io.Reader = os.Stdin
+	if !c.Bool("stdin") {
+		f, err := os.Open(c.String("file"))
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if k.Pure() {
+		opts, err := k.SignerOpts(crypto.Hash(0), signParams(c))
+		if err != nil {
+			return nil, nil, err
+		}
+		message, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return message, opts, nil
+	}
+
+	hash, digest, err := hashes.Sum(c.String("hash"), r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts, err := k.SignerOpts(hash, signParams(c))
+	if err != nil {
+		return nil, nil, err
+	}
+	return digest, opts, nil
+}
+
+// signParams returns the signing options given by the flags of the sign command.
+func signParams(c *cli.Context) key.SignParams {
+	p := key.SignParams{
+		Padding:     c.String("padding"),
+		LowS:        c.Bool("low-s"),
+		Recoverable: c.Bool("recoverable"),
+	}
+	if c.IsSet("salt-length") {
+		saltLength := c.Int("salt-length")
+		p.SaltLength = &saltLength
+	}
+	return p
+}
+
+var rotateKeyCmd = cli.Command{
+	Name:   "rotate",
+	Usage:  "create a new primary version of a key",
+	Action: createClientFunc(rotateKey),
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "id",
+			Usage: "the key identifier",
+		},
+	},
+}
+
+func rotateKey(_ *config, s key.Storage, c *cli.Context) error {
+	id := c.String("id")
+	if id == "" {
+		return errors.New("id must not be empty")
+	}
+
+	k, err := s.Rotate(context.Background(), id)
 	if err != nil {
 		return err
 	}
+	fmt.Printf("Rotated key %s to version %d\n", k.ID, k.Version)
+	return nil
+}
 
-	h := c.String("hash")
-	hash, ok := hashes[h]
-	if !ok {
-		return fmt.Errorf("Hash '%s' is not supported", h)
+// setKeyStateCmd returns the command transitioning keys to state.
+func setKeyStateCmd(name, state, usage string) cli.Command {
+	return cli.Command{
+		Name:  name,
+		Usage: usage,
+		Action: createClientFunc(func(_ *config, s key.Storage, c *cli.Context) error {
+			id := c.String("id")
+			if id == "" {
+				return errors.New("id must not be empty")
+			}
+
+			k, err := s.SetState(context.Background(), id, state)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Key %s is %s\n", k.ID, k.GetState())
+			return nil
+		}),
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "id",
+				Usage: "the key identifier",
+			},
+		},
 	}
+}
 
-	k, err := s.Get(id)
+var deleteKeyCmd = cli.Command{
+	Name:   "delete",
+	Usage:  "schedule a key to be destroyed after a waiting period",
+	Action: createClientFunc(deleteKey),
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "id",
+			Usage: "the key identifier",
+		},
+		cli.DurationFlag{
+			Name:  "waiting-period",
+			Usage: "how long the key can be restored before it is destroyed",
+			Value: key.DefaultDeletionWaitingPeriod,
+		},
+	},
+}
+
+func deleteKey(_ *config, s key.Storage, c *cli.Context) error {
+	id := c.String("id")
+	if id == "" {
+		return errors.New("id must not be empty")
+	}
+
+	k, err := s.ScheduleDeletion(context.Background(), id, c.Duration("waiting-period"))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Key %s will be destroyed at %s\n", k.ID, k.DeletionTime.Format(time.RFC3339))
+	return nil
+}
+
+var restoreKeyCmd = cli.Command{
+	Name:   "restore",
+	Usage:  "restore a key scheduled for deletion",
+	Action: createClientFunc(restoreKey),
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "id",
+			Usage: "the key identifier",
+		},
+	},
+}
+
+func restoreKey(_ *config, s key.Storage, c *cli.Context) error {
+	id := c.String("id")
+	if id == "" {
+		return errors.New("id must not be empty")
+	}
+
+	k, err := s.CancelDeletion(context.Background(), id)
 	if err != nil {
 		return err
 	}
+	fmt.Printf("Restored key %s\n", k.ID)
+	return nil
+}
 
-	signature, err := k.Signer.Sign(rand.Reader, bDigest, hash)
+var purgeKeysCmd = cli.Command{
+	Name:   "purge",
+	Usage:  "destroy keys whose deletion time has passed",
+	Action: createClientFunc(purgeKeys),
+}
+
+func purgeKeys(_ *config, s key.Storage, c *cli.Context) error {
+	n, err := s.Purge(context.Background())
 	if err != nil {
 		return err
 	}
+	fmt.Printf("Destroyed %d keys\n", n)
+	return nil
+}
 
-	fmt.Printf("%v", signature)
+var reencodeCmd = cli.Command{
+	Name:   "reencode",
+	Usage:  "migrate stored keys to the current encoding",
+	Action: createClientFunc(reencode),
+}
+
+func reencode(_ *config, s key.Storage, c *cli.Context) error {
+	r, ok := s.(key.Reencoder)
+	if !ok {
+		return errors.New("storage does not support reencoding")
+	}
+
+	n, err := r.Reencode()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reencoded %d keys\n", n)
 	return nil
 }
+
+var rewrapCmd = cli.Command{
+	Name:        "rewrap",
+	Usage:       "rewrap the data keys of stored keys with the primary key-encryption key",
+	Description: "Keys which aren't envelope encrypted yet are skipped. Run reencode first to migrate them.",
+	Action:      createClientFunc(rewrap),
+}
+
+func rewrap(_ *config, s key.Storage, c *cli.Context) error {
+	r, ok := s.(key.Rewrapper)
+	if !ok {
+		return errors.New("storage does not support rewrapping")
+	}
+
+	n, err := r.Rewrap()
+	if err != nil && !errors.Is(err, key.ErrNotEnvelope) {
+		return err
+	}
+	fmt.Printf("Rewrapped %d keys\n", n)
+	return err
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/urfave/cli"
+
+	"github.com/belljustin/hancock/key"
+	"github.com/belljustin/hancock/key/shamir"
+)
+
+// OperatorCmd is the command for operating a hancock REST server
+var OperatorCmd = cli.Command{
+	Name:  "operator",
+	Usage: "operate a hancock server",
+	Subcommands: []cli.Command{
+		initCmd,
+		unsealCmd,
+	},
+}
+
+var initCmd = cli.Command{
+	Name:   "init",
+	Usage:  "generate a new secret and split it into shares for unsealing",
+	Action: initSecret,
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "shares",
+			Usage: "the number of shares to split the secret into",
+			Value: 5,
+		},
+		cli.IntFlag{
+			Name:  "threshold",
+			Usage: "the number of shares required to unseal",
+			Value: 3,
+		},
+	},
+}
+
+// initSecret generates a hex encoded, 256-bit secret, which is usable as a raw AES key or a
+// key-encryption key, and prints its shares. The secret itself is never printed.
+func initSecret(c *cli.Context) error {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return err
+	}
+	secret := []byte(hex.EncodeToString(b))
+
+	shares, err := shamir.Split(secret, c.Int("shares"), c.Int("threshold"))
+	if err != nil {
+		return err
+	}
+
+	for i, s := range shares {
+		fmt.Printf("Share %d: %x\n", i+1, s)
+	}
+	fmt.Printf("\nUnseal with %d of the %d shares.\n", c.Int("threshold"), c.Int("shares"))
+	return nil
+}
+
+var unsealCmd = cli.Command{
+	Name:   "unseal",
+	Usage:  "submit a share, read from the terminal, to unseal a running server",
+	Action: unseal,
+}
+
+func unseal(c *cli.Context) error {
+	conf, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("shares can only be entered on a terminal: %v", err)
+	}
+	share, err := readShare(bufio.NewReader(tty), tty, "Share: ")
+	tty.Close()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]string{"share": hex.EncodeToString(share)})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s:%d/sys/unseal", conf.Server.Host, conf.Server.Port)
+	res, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var herr struct {
+			Message string
+		}
+		json.NewDecoder(res.Body).Decode(&herr)
+		return fmt.Errorf("unseal failed with status %d: %s", res.StatusCode, herr.Message)
+	}
+
+	var status key.SealStatus
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		return err
+	}
+	if status.Sealed {
+		fmt.Printf("Sealed: %d of %d shares submitted\n", status.Progress, status.Threshold)
+	} else {
+		fmt.Println("Unsealed")
+	}
+	return nil
+}
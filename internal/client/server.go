@@ -25,7 +25,9 @@ func runServer(c *cli.Context) error {
 
 	s, err := key.Open(conf.Backend, conf.Storage)
 	if err != nil {
-		return err
+		return exitError(err)
 	}
-	return server.Run(conf.Server.Port, s)
+	defer s.Close()
+
+	return server.Run(conf.Server.Port, s, conf.Hashes.GetHashes())
 }
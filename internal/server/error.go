@@ -1,9 +1,14 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/belljustin/hancock/key"
 )
 
 type httpError struct {
@@ -15,11 +20,58 @@ func (err *httpError) Error() string {
 	return fmt.Sprintf("%d: %s", err.Code, err.Message)
 }
 
+// keyErrors maps errors of the key package to HTTP status codes. Errors which only concern the
+// server report a generic message instead of the error.
+var keyErrors = []struct {
+	err     error
+	code    int
+	message string
+}{
+	{key.ErrNotFound, http.StatusNotFound, ""},
+	{key.ErrInvalidID, http.StatusBadRequest, ""},
+	{key.ErrInvalidListOptions, http.StatusBadRequest, ""},
+	{key.ErrInvalidWaitingPeriod, http.StatusBadRequest, ""},
+	{key.ErrInvalidOpts, http.StatusBadRequest, ""},
+	{key.ErrInvalidMetadata, http.StatusBadRequest, ""},
+	{key.ErrInvalidState, http.StatusBadRequest, ""},
+	{key.ErrUnsupportedAlgorithm, http.StatusBadRequest, ""},
+	{key.ErrDisabled, http.StatusConflict, ""},
+	{key.ErrCompromised, http.StatusConflict, ""},
+	{key.ErrNotYetValid, http.StatusConflict, ""},
+	{key.ErrExpired, http.StatusConflict, ""},
+	{key.ErrSignatureLimit, http.StatusConflict, ""},
+	{key.ErrUsageNotAllowed, http.StatusForbidden, ""},
+	{key.ErrInvalidStateTransition, http.StatusConflict, ""},
+	{key.ErrPendingDeletion, http.StatusConflict, ""},
+	{key.ErrDestroyed, http.StatusGone, ""},
+	{key.ErrSealed, http.StatusServiceUnavailable, "Hancock is sealed"},
+	{key.ErrKeyMismatch, http.StatusInternalServerError, "Master key does not match the key storage"},
+	{key.ErrDecrypt, http.StatusInternalServerError, "Could not decrypt key"},
+}
+
+// handleError aborts the request with the status code of err. Errors which are neither mapped by
+// `keyErrors` nor an `httpError` are logged and reported as an internal server error.
 func handleError(c *gin.Context, err error) {
-	if herr, ok := err.(*httpError); ok {
-		c.Error(herr)
-		c.AbortWithStatusJSON(herr.Code, &herr)
-	} else {
-		panic(err)
+	for _, kerr := range keyErrors {
+		if errors.Is(err, kerr.err) {
+			message := kerr.message
+			if message == "" {
+				message = err.Error()
+			}
+			err = &httpError{kerr.code, message}
+			break
+		}
+	}
+
+	herr, ok := err.(*httpError)
+	if !ok {
+		// The cause is only logged, since it may reveal details of the storage.
+		log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+		herr = &httpError{
+			http.StatusInternalServerError,
+			"Internal server error",
+		}
 	}
+	c.Error(herr)
+	c.AbortWithStatusJSON(herr.Code, &herr)
 }
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/belljustin/hancock/key"
+)
+
+const (
+	// purgeInterval is how often keys whose deletion time has passed are destroyed.
+	purgeInterval = time.Minute
+	// rotateInterval is how often keys whose rotation is due are rotated.
+	rotateInterval = time.Minute
+)
+
+// job is a background task over keys. It returns the number of keys it changed.
+type job func(ctx context.Context) (int, error)
+
+// runJobs runs the background jobs of s until ctx is done. State is kept in the storage, so the
+// jobs pick up where they left off after a restart. Jobs are safe to run while several servers
+// share a storage.
+func runJobs(ctx context.Context, s key.Storage) {
+	go runJob(ctx, "purge", s.Purge, purgeInterval)
+	go runJob(ctx, "rotate", s.RotateDue, rotateInterval)
+}
+
+// runJob runs j every interval until ctx is done, logging the number of keys it changed. Errors
+// are not logged while the storage is sealed.
+func runJob(ctx context.Context, name string, j job, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		n, err := j(ctx)
+		if n > 0 {
+			log.Printf("%s job changed %d keys", name, n)
+		}
+		if err != nil && ctx.Err() == nil && !errors.Is(err, key.ErrSealed) {
+			log.Printf("%s job failed: %v", name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
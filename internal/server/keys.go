@@ -1,12 +1,19 @@
 package server
 
 import (
+	"context"
 	"crypto"
 	"crypto/rand"
+	"crypto/x509"
 	"encoding/hex"
 	_ "encoding/json" // for tagging structs
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/gin-gonic/gin/binding" // for gin bindings
@@ -14,19 +21,17 @@ import (
 	"github.com/belljustin/hancock/key"
 )
 
-var hashes = map[string]crypto.Hash{
-	"sha256": crypto.SHA256,
-}
-
 type keysHandler struct {
-	keys key.Storage
+	keys   key.Storage
+	hashes *key.HashRegistry
 }
 
-func (h *keysHandler) getKeyByID(id string) (*key.Key, error) {
-	k, err := h.keys.Get(id)
+func (h *keysHandler) getKeyByID(ctx context.Context, id string) (*key.Key, error) {
+	k, err := h.keys.GetContext(ctx, id)
 	if err != nil {
 		return nil, err
 	} else if k == nil {
+		// Drivers written before `key.ErrNotFound` return a nil key instead.
 		return nil, &httpError{
 			http.StatusNotFound,
 			fmt.Sprintf("Could not find key id '%s'", id),
@@ -36,28 +41,149 @@ func (h *keysHandler) getKeyByID(id string) (*key.Key, error) {
 	return k, nil
 }
 
+// getSigningKeyByID is like getKeyByID, but fails if the key must not be used for signing.
+func (h *keysHandler) getSigningKeyByID(ctx context.Context, id string) (*key.Key, error) {
+	k, err := h.getKeyByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.CheckSign(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
 type getKeyResponse struct {
 	ID        string           `json:"id"`
 	Algorithm string           `json:"alg"`
 	PublicKey crypto.PublicKey `json:"public_key"`
+	key.Metadata
+	// State is enabled, disabled or compromised. Only enabled keys can sign.
+	State         string     `json:"state"`
+	CompromisedAt *time.Time `json:"compromised_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	// PublicKeyDER is the PKIX, ASN.1 DER encoding of the public key. Unlike PublicKey, it keeps
+	// the curve of ECDSA keys.
+	PublicKeyDER []byte `json:"public_key_der,omitempty"`
+	// DeletionTime is the time the key will be destroyed, if it is scheduled for deletion.
+	DeletionTime *time.Time `json:"deletion_time,omitempty"`
+	// NextRotationTime is the time the key will be rotated automatically, if it has a rotation
+	// period.
+	NextRotationTime *time.Time `json:"next_rotation_time,omitempty"`
+	// Version is the primary version, whose public key is PublicKey.
+	Version int `json:"version"`
+	// Versions are the public keys of every version that hasn't been destroyed.
+	Versions []getVersionResponse `json:"versions"`
+}
+
+type getVersionResponse struct {
+	Version      int              `json:"version"`
+	PublicKey    crypto.PublicKey `json:"public_key"`
+	PublicKeyDER []byte           `json:"public_key_der,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
 }
 
 func (h *keysHandler) getKey(c *gin.Context) {
-	k, err := h.getKeyByID(c.Param("id"))
+	k, err := h.getKeyByID(c.Request.Context(), c.Param("id"))
 	if err != nil {
 		handleError(c, err)
 		return
 	}
+	pub := k.Signer.Public()
+	// Not every public key has a PKIX encoding, in which case it is omitted.
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+
+	versions := make([]getVersionResponse, 0, len(k.Versions))
+	for _, v := range k.Versions {
+		vpub := v.Signer.Public()
+		vder, _ := x509.MarshalPKIXPublicKey(vpub)
+		versions = append(versions, getVersionResponse{
+			Version:      v.Version,
+			PublicKey:    vpub,
+			PublicKeyDER: vder,
+			CreatedAt:    v.CreatedAt,
+		})
+	}
+
 	c.JSON(200, &getKeyResponse{
-		ID:        k.ID,
-		Algorithm: k.Algorithm,
-		PublicKey: k.Signer.Public(),
+		ID:               k.ID,
+		Algorithm:        k.Algorithm,
+		PublicKey:        pub,
+		PublicKeyDER:     der,
+		Metadata:         k.Metadata,
+		State:            k.GetState(),
+		CompromisedAt:    k.CompromisedAt,
+		CreatedAt:        k.CreatedAt,
+		UpdatedAt:        k.UpdatedAt,
+		DeletionTime:     k.DeletionTime,
+		NextRotationTime: k.NextRotationTime,
+		Version:          k.Version,
+		Versions:         versions,
+	})
+}
+
+type listKeysRequest struct {
+	Algorithm     string    `form:"alg"`
+	CreatedSince  time.Time `form:"created_since" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	// ExpiresBefore lists keys with a not after time before it, to find keys to rotate ahead of
+	// expiry.
+	ExpiresBefore time.Time `form:"expires_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	// Labels are name=value pairs which listed keys must all have.
+	Labels []string `form:"label"`
+	Cursor string   `form:"cursor"`
+	Limit  int      `form:"limit"`
+}
+
+func (h *keysHandler) listKeys(c *gin.Context) {
+	var lk listKeysRequest
+	if err := c.ShouldBindQuery(&lk); err != nil {
+		handleError(c, &httpError{
+			http.StatusBadRequest,
+			err.Error(),
+		})
+		return
+	}
+
+	labels, err := key.ParseLabels(lk.Labels)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	l, err := h.keys.List(c.Request.Context(), key.ListOptions{
+		Algorithm:     lk.Algorithm,
+		CreatedSince:  lk.CreatedSince,
+		CreatedBefore: lk.CreatedBefore,
+		ExpiresBefore: lk.ExpiresBefore,
+		Labels:        labels,
+		Cursor:        lk.Cursor,
+		Limit:         lk.Limit,
 	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, l)
 }
 
 type createKeyRequest struct {
-	Algorithm string   `json:"alg" binding:"required"`
-	Opts      key.Opts `json:"opts"`
+	Algorithm string `json:"alg" binding:"required"`
+	// Opts are validated by the algorithm's schema, such as {"bits": 4096} for RSA keys.
+	Opts        key.Opts          `json:"opts"`
+	Labels      map[string]string `json:"labels"`
+	Description string            `json:"description"`
+	Creator     string            `json:"creator"`
+	// RotationPeriod optionally rotates the key automatically, such as every "720h".
+	RotationPeriod key.Duration `json:"rotation_period"`
+	// NotBefore and NotAfter optionally limit the period in which the key can sign.
+	NotBefore *time.Time `json:"not_before"`
+	NotAfter  *time.Time `json:"not_after"`
+	// AllowedHashes, AllowedPaddings and MaxSignatures optionally constrain how the key signs.
+	AllowedHashes   []string `json:"allowed_hashes"`
+	AllowedPaddings []string `json:"allowed_paddings"`
+	MaxSignatures   int64    `json:"max_signatures"`
 }
 
 type createKeyResponse struct {
@@ -74,9 +200,22 @@ func (h *keysHandler) createKey(c *gin.Context) {
 		return
 	}
 
-	// TODO: cleanup opts
-	k, err := h.keys.Create(ck.Algorithm, ck.Opts)
-	if err != nil {
+	k, err := h.keys.CreateContext(c.Request.Context(), ck.Algorithm, ck.Opts, key.Metadata{
+		Labels:          ck.Labels,
+		Description:     ck.Description,
+		Creator:         ck.Creator,
+		RotationPeriod:  ck.RotationPeriod,
+		NotBefore:       ck.NotBefore,
+		NotAfter:        ck.NotAfter,
+		AllowedHashes:   ck.AllowedHashes,
+		AllowedPaddings: ck.AllowedPaddings,
+		MaxSignatures:   ck.MaxSignatures,
+	})
+	if errors.Is(err, key.ErrSealed) || errors.Is(err, key.ErrUnsupportedAlgorithm) ||
+		errors.Is(err, key.ErrInvalidOpts) || errors.Is(err, key.ErrInvalidMetadata) {
+		handleError(c, err)
+		return
+	} else if err != nil {
 		// TODO: figure out how to handle errors
 		handleError(c, &httpError{
 			http.StatusBadRequest,
@@ -90,16 +229,39 @@ func (h *keysHandler) createKey(c *gin.Context) {
 }
 
 type createSignatureRequest struct {
-	Digest string `json:"digest" binding:"required"`
-	Hash   string `json:"hash" binding:"required"`
+	// Digest and Hash are required by keys that sign digests.
+	Digest string `json:"digest"`
+	Hash   string `json:"hash"`
+	// Padding optionally selects the RSA padding scheme, either pkcs1v15 (default) or pss.
+	Padding string `json:"padding"`
+	// SaltLength is the PSS salt length with the semantics of rsa.PSSOptions. If it is not
+	// provided, the salt length equals the hash length.
+	SaltLength *int `json:"salt_length"`
+	// LowS normalizes secp256k1 signatures to low-S and Recoverable produces 65 byte r||s||v
+	// secp256k1 signatures, as in `key.Secp256k1SignerOpts`.
+	LowS        bool `json:"low_s"`
+	Recoverable bool `json:"recoverable"`
+	// Message is required by pure keys, such as Ed25519, that sign the full message.
+	Message string `json:"message"`
+}
+
+func (cs *createSignatureRequest) signParams() key.SignParams {
+	return key.SignParams{
+		Padding:     cs.Padding,
+		SaltLength:  cs.SaltLength,
+		LowS:        cs.LowS,
+		Recoverable: cs.Recoverable,
+	}
 }
 
 type createSignatureResponse struct {
 	Signature []byte `json:"signature"`
+	// Version is the version of the key which signed, whose public key verifies the signature.
+	Version int `json:"version"`
 }
 
 func (h *keysHandler) createSignature(c *gin.Context) {
-	k, err := h.getKeyByID(c.Param("id"))
+	k, err := h.getSigningKeyByID(c.Request.Context(), c.Param("id"))
 	if err != nil {
 		handleError(c, err)
 		return
@@ -114,39 +276,319 @@ func (h *keysHandler) createSignature(c *gin.Context) {
 		return
 	}
 
-	hash, ok := hashes[cs.Hash]
-	if !ok {
+	ctx := c.Request.Context()
+	var sig []byte
+	if k.Pure() {
+		sig, err = h.signMessage(ctx, k, &cs)
+	} else {
+		sig, err = h.signDigest(ctx, k, &cs)
+	}
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	res := &createSignatureResponse{Signature: sig, Version: k.Version}
+	c.JSON(http.StatusCreated, &res)
+}
+
+func (h *keysHandler) signMessage(ctx context.Context, k *key.Key, cs *createSignatureRequest) ([]byte, error) {
+	if cs.Message == "" {
+		return nil, &httpError{
+			http.StatusBadRequest,
+			fmt.Sprintf("Message is required for '%s' keys", k.Algorithm),
+		}
+	}
+
+	bMessage, err := hex.DecodeString(cs.Message)
+	if err != nil {
+		return nil, &httpError{
+			http.StatusBadRequest,
+			"Message must be hex encoded",
+		}
+	}
+
+	return h.signWithHash(ctx, k, bMessage, crypto.Hash(0), cs.signParams())
+}
+
+func (h *keysHandler) signDigest(ctx context.Context, k *key.Key, cs *createSignatureRequest) ([]byte, error) {
+	if cs.Digest == "" || cs.Hash == "" {
+		return nil, &httpError{
+			http.StatusBadRequest,
+			fmt.Sprintf("Digest and hash are required for '%s' keys", k.Algorithm),
+		}
+	}
+
+	bDigest, err := hex.DecodeString(cs.Digest)
+	if err != nil {
+		return nil, &httpError{
+			http.StatusBadRequest,
+			"Digest must be hex encoded",
+		}
+	}
+
+	if err := k.CheckUsage(cs.Hash, cs.Padding); err != nil {
+		return nil, err
+	}
+
+	hash, err := h.hashes.Digest(cs.Hash, bDigest)
+	if err != nil {
+		return nil, &httpError{
+			http.StatusBadRequest,
+			err.Error(),
+		}
+	}
+
+	return h.signWithHash(ctx, k, bDigest, hash, cs.signParams())
+}
+
+func (h *keysHandler) signWithHash(ctx context.Context, k *key.Key, digest []byte, hash crypto.Hash, p key.SignParams) ([]byte, error) {
+	opts, err := k.SignerOpts(hash, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.sign(ctx, k, digest, opts)
+}
+
+// sign counts a signature by k before signing with it, so that keys never sign more than their
+// maximum number of signatures. Every option must be validated beforehand. If signing fails
+// anyway, the signature is refunded.
+func (h *keysHandler) sign(ctx context.Context, k *key.Key, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if err := h.keys.CountSignature(ctx, k.ID); err != nil {
+		return nil, err
+	}
+
+	sig, err := k.Signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		// The request may have been canceled, but the refund must not be.
+		if rerr := h.keys.RefundSignature(context.Background(), k.ID); rerr != nil {
+			log.Printf("could not refund signature of key %s: %v", k.ID, rerr)
+		}
+		return nil, &httpError{
+			http.StatusInternalServerError,
+			"Could not sign",
+		}
+	}
+	return sig, nil
+}
+
+// maxPureMessageSize limits the size of messages signed by pure keys, which can't be streamed.
+const maxPureMessageSize = 10 << 20
+
+// createMessageSignature signs the raw request body. Unless the key is pure, the body is streamed
+// through the hash given by the hash query parameter and the digest is signed. The padding,
+// salt_length, low_s and recoverable query parameters are as in `createSignatureRequest`.
+func (h *keysHandler) createMessageSignature(c *gin.Context) {
+	k, err := h.getSigningKeyByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var sig []byte
+	if k.Pure() {
+		sig, err = h.signBody(k, c)
+	} else {
+		sig, err = h.hashAndSignBody(k, c)
+	}
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	res := &createSignatureResponse{Signature: sig, Version: k.Version}
+	c.JSON(http.StatusCreated, &res)
+}
+
+func (h *keysHandler) signBody(k *key.Key, c *gin.Context) ([]byte, error) {
+	// Pure keys don't take any options, so those given are rejected before reading the body.
+	p, err := signParamsFromQuery(c)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := k.SignerOpts(crypto.Hash(0), p)
+	if err != nil {
+		return nil, err
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxPureMessageSize)
+	message, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, &httpError{
+			http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Messages signed by '%s' keys must not exceed %d bytes", k.Algorithm, maxPureMessageSize),
+		}
+	}
+
+	return h.sign(c.Request.Context(), k, message, opts)
+}
+
+func (h *keysHandler) hashAndSignBody(k *key.Key, c *gin.Context) ([]byte, error) {
+	p, err := signParamsFromQuery(c)
+	if err != nil {
+		return nil, err
+	}
+
+	hashName := c.DefaultQuery("hash", "sha256")
+	if err := k.CheckUsage(hashName, p.Padding); err != nil {
+		return nil, err
+	}
+
+	hash, digest, err := h.hashes.Sum(hashName, c.Request.Body)
+	if err != nil {
+		return nil, &httpError{
+			http.StatusBadRequest,
+			err.Error(),
+		}
+	}
+
+	return h.signWithHash(c.Request.Context(), k, digest, hash, p)
+}
+
+// signParamsFromQuery reads the padding, salt_length, low_s and recoverable query parameters.
+func signParamsFromQuery(c *gin.Context) (key.SignParams, error) {
+	p := key.SignParams{Padding: c.Query("padding")}
+	if sl, ok := c.GetQuery("salt_length"); ok {
+		saltLength, err := strconv.Atoi(sl)
+		if err != nil {
+			return p, &httpError{
+				http.StatusBadRequest,
+				"Salt length must be an integer",
+			}
+		}
+		p.SaltLength = &saltLength
+	}
+
+	for name, b := range map[string]*bool{"low_s": &p.LowS, "recoverable": &p.Recoverable} {
+		v, ok := c.GetQuery(name)
+		if !ok {
+			continue
+		}
+		var err error
+		if *b, err = strconv.ParseBool(v); err != nil {
+			return p, &httpError{
+				http.StatusBadRequest,
+				fmt.Sprintf("%s must be a boolean", name),
+			}
+		}
+	}
+	return p, nil
+}
+
+func (h *keysHandler) updateKey(c *gin.Context) {
+	var u key.MetadataUpdate
+	if err := c.ShouldBindJSON(&u); err != nil {
 		handleError(c, &httpError{
 			http.StatusBadRequest,
-			fmt.Sprintf("Hash '%s' is not supported", cs.Hash),
+			"Malformed request",
 		})
 		return
 	}
 
-	bDigest, err := hex.DecodeString(cs.Digest)
+	k, err := h.keys.UpdateMetadata(c.Request.Context(), c.Param("id"), u)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, k)
+}
+
+// setKeyState returns a handler transitioning keys to state.
+func (h *keysHandler) setKeyState(state string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k, err := h.keys.SetState(c.Request.Context(), c.Param("id"), state)
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, k)
+	}
+}
+
+type rotateKeyResponse struct {
+	ID string `json:"id"`
+	// Version is the new primary version of the key.
+	Version int `json:"version"`
+}
+
+func (h *keysHandler) rotateKey(c *gin.Context) {
+	k, err := h.keys.Rotate(c.Request.Context(), c.Param("id"))
 	if err != nil {
+		handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, &rotateKeyResponse{k.ID, k.Version})
+}
+
+type deleteKeyRequest struct {
+	// WaitingPeriod is how long the key can be restored before it is destroyed, such as "720h".
+	WaitingPeriod string `form:"waiting_period"`
+}
+
+type deleteKeyResponse struct {
+	ID           string     `json:"id"`
+	DeletionTime *time.Time `json:"deletion_time"`
+}
+
+func (h *keysHandler) deleteKey(c *gin.Context) {
+	var dk deleteKeyRequest
+	if err := c.ShouldBindQuery(&dk); err != nil {
 		handleError(c, &httpError{
 			http.StatusBadRequest,
-			"Digest must be hex encoded",
+			err.Error(),
 		})
 		return
 	}
 
-	sig, err := k.Signer.Sign(rand.Reader, bDigest, hash)
+	var waitingPeriod time.Duration
+	if dk.WaitingPeriod != "" {
+		var err error
+		if waitingPeriod, err = time.ParseDuration(dk.WaitingPeriod); err != nil {
+			handleError(c, &httpError{
+				http.StatusBadRequest,
+				err.Error(),
+			})
+			return
+		}
+	}
+
+	k, err := h.keys.ScheduleDeletion(c.Request.Context(), c.Param("id"), waitingPeriod)
 	if err != nil {
-		panic(err)
+		handleError(c, err)
+		return
 	}
+	c.JSON(http.StatusOK, &deleteKeyResponse{k.ID, k.DeletionTime})
+}
 
-	res := &createSignatureResponse{Signature: sig}
-	c.JSON(http.StatusCreated, &res)
+type restoreKeyResponse struct {
+	ID string `json:"id"`
+}
+
+func (h *keysHandler) restoreKey(c *gin.Context) {
+	k, err := h.keys.CancelDeletion(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, &restoreKeyResponse{k.ID})
 }
 
-func registerKeyHandlers(r *gin.Engine, s key.Storage) {
-	h := &keysHandler{s}
+func registerKeyHandlers(r *gin.Engine, s key.Storage, hashes *key.HashRegistry) {
+	h := &keysHandler{s, hashes}
 
 	kr := r.Group("/keys")
 
+	kr.GET("/", h.listKeys)
 	kr.POST("/", h.createKey)
 	kr.GET("/:id", h.getKey)
+	kr.PATCH("/:id", h.updateKey)
+	kr.DELETE("/:id", h.deleteKey)
+	kr.POST("/:id/restore", h.restoreKey)
+	kr.POST("/:id/rotate", h.rotateKey)
+	kr.POST("/:id/enable", h.setKeyState(key.Enabled))
+	kr.POST("/:id/disable", h.setKeyState(key.Disabled))
+	kr.POST("/:id/compromise", h.setKeyState(key.Compromised))
 	kr.POST("/:id/signature", h.createSignature)
+	kr.POST("/:id/sign-message", h.createMessageSignature)
 }
@@ -1,9 +1,14 @@
 package server
 
 import (
+	"context"
 	_ "encoding/json" // for tagging json structs
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -16,16 +21,47 @@ type Config struct {
 	Port int    `json:"port"`
 }
 
+// shutdownTimeout is how long in-flight requests are given to complete on shutdown.
+const shutdownTimeout = 10 * time.Second
+
 func ping(c *gin.Context) {
 	c.String(http.StatusOK, "Pong")
 }
 
-// Run a hancock REST server using s as the backend `key.Storage`.
-func Run(port int, s key.Storage) error {
+// Run a hancock REST server using s as the backend `key.Storage`. Digests may only be signed with
+// the hashes available in hashes. On SIGINT or SIGTERM, the server stops accepting requests and
+// Run returns once in-flight requests have completed. Closing s is left to the caller. While the
+// server runs, keys whose deletion time has passed are destroyed and keys whose rotation is due
+// are rotated periodically.
+func Run(port int, s key.Storage, hashes *key.HashRegistry) error {
 	router := gin.Default()
 
 	router.GET("/ping", ping)
-	registerKeyHandlers(router, s)
+	registerKeyHandlers(router, s, hashes)
+	registerSysHandlers(router, s)
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: router,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runJobs(ctx, s)
+
+	shutdown := make(chan error, 1)
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		shutdown <- srv.Shutdown(ctx)
+	}()
 
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), router)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return <-shutdown
 }
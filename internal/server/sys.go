@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/hex"
+	_ "encoding/json" // for tagging structs
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/belljustin/hancock/key"
+)
+
+type sysHandler struct {
+	sealer key.Sealer
+}
+
+func (h *sysHandler) getSealStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.sealer.SealStatus())
+}
+
+type unsealRequest struct {
+	Share string `json:"share" binding:"required"`
+}
+
+func (h *sysHandler) unseal(c *gin.Context) {
+	var ur unsealRequest
+	if err := c.ShouldBind(&ur); err != nil {
+		handleError(c, &httpError{
+			http.StatusBadRequest,
+			"Malformed request",
+		})
+		return
+	}
+
+	share, err := hex.DecodeString(ur.Share)
+	if err != nil {
+		handleError(c, &httpError{
+			http.StatusBadRequest,
+			"Share must be hex encoded",
+		})
+		return
+	}
+
+	status, err := h.sealer.Unseal(share)
+	if err != nil {
+		handleError(c, &httpError{
+			http.StatusBadRequest,
+			err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+func registerSysHandlers(r *gin.Engine, s key.Storage) {
+	sealer, ok := s.(key.Sealer)
+	if !ok {
+		return
+	}
+	h := &sysHandler{sealer}
+
+	sr := r.Group("/sys")
+
+	sr.GET("/seal-status", h.getSealStatus)
+	sr.POST("/unseal", h.unseal)
+}
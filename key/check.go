@@ -0,0 +1,41 @@
+package key
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// keyCheckID binds key check values to their purpose, so they can't be mistaken for a stored key.
+const keyCheckID = "hancock-key-check"
+
+// keyCheckSigner is the canary encoded by key check values. It is not secret.
+var keyCheckSigner = func() ed25519.PrivateKey {
+	seed := sha256.Sum256([]byte(keyCheckID))
+	return ed25519.NewKeyFromSeed(seed[:])
+}()
+
+// NewKeyCheck returns a key check value, which is a canary encoded by c. Storages keep it
+// alongside their keys so `VerifyKeyCheck` can detect a wrong secret before any key is used.
+func NewKeyCheck(c MultiCodec) ([]byte, error) {
+	return EncodeKey(c, keyCheckID, keyCheckSigner, ED25519)
+}
+
+// VerifyKeyCheck verifies that the key check value check decodes with c. Otherwise, it returns an
+// error wrapping `ErrKeyMismatch`, unless c is sealed in which case `ErrSealed` is returned.
+func VerifyKeyCheck(c MultiCodec, check []byte) error {
+	s, err := DecodeKey(c, keyCheckID, check, ED25519)
+	if errors.Is(err, ErrSealed) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", ErrKeyMismatch, err)
+	}
+
+	pub, ok := s.Public().(ed25519.PublicKey)
+	if !ok || !bytes.Equal(pub, keyCheckSigner.Public().(ed25519.PublicKey)) {
+		return ErrKeyMismatch
+	}
+	return nil
+}
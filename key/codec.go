@@ -5,25 +5,42 @@ import (
 	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
 )
 
 var (
-	// DefaultCodec is a sensible default that supports rsa.
+	// DefaultCodec is a sensible default that supports rsa, ecdsa, ed25519 and secp256k1. Keys are
+	// encoded with PKCS #8 and keys encoded by `LegacyCodec` can still be decoded.
 	DefaultCodec MultiCodec
+
+	// LegacyCodec supports the algorithm specific encodings used before PKCS #8 was introduced,
+	// including the gob encoding of rsa keys.
+	LegacyCodec MultiCodec
 )
 
 func init() {
-	DefaultCodec = &multiCodec{
+	LegacyCodec = &multiCodec{
 		map[string]Codec{
-			"rsa": &RsaGobCodec{},
+			"rsa":       &RsaGobCodec{},
+			"ecdsa":     &EcdsaDerCodec{},
+			"ed25519":   &Ed25519SeedCodec{},
+			"secp256k1": &Secp256k1Codec{},
 		},
 	}
+	DefaultCodec = &Pkcs8MultiCodec{Legacy: LegacyCodec}
 }
 
 // Codec is an interface for (de)serializing an algorithm's Signer. This is convenient for
@@ -43,6 +60,58 @@ type MultiCodec interface {
 	Decode(priv []byte, alg string) (s crypto.Signer, err error)
 }
 
+// AssociatedDataCodec is a `MultiCodec` which can bind serialized Signers to associated data,
+// typically the output of `AssociatedData`. Encrypting codecs implement it so that serialized
+// Signers can't be swapped between keys, or have their algorithm changed, without detection.
+type AssociatedDataCodec interface {
+	MultiCodec
+	// EncodeWithAD serializes the Signer, binding it to the associated data ad.
+	EncodeWithAD(s crypto.Signer, alg string, ad []byte) (priv []byte, err error)
+	// DecodeWithAD deserializes the private key, which must be bound to the associated data ad.
+	DecodeWithAD(priv []byte, alg string, ad []byte) (s crypto.Signer, err error)
+}
+
+// AssociatedData returns the associated data binding a serialized Signer to the key id of
+// algorithm alg.
+func AssociatedData(id, alg string) []byte {
+	ad := make([]byte, 0, 4+len(id)+len(alg))
+	ad = append(ad, byte(len(id)>>8), byte(len(id)))
+	ad = append(ad, id...)
+	ad = append(ad, byte(len(alg)>>8), byte(len(alg)))
+	return append(ad, alg...)
+}
+
+// EncodeKey serializes s with c, binding it to the key id if c is an `AssociatedDataCodec`.
+func EncodeKey(c MultiCodec, id string, s crypto.Signer, alg string) ([]byte, error) {
+	return encodeWithAD(c, s, alg, AssociatedData(id, alg))
+}
+
+// DecodeKey deserializes priv with c, checking that it is bound to the key id if c is an
+// `AssociatedDataCodec`. Unless the codec is sealed or doesn't support alg, errors wrap
+// `ErrDecrypt`.
+func DecodeKey(c MultiCodec, id string, priv []byte, alg string) (crypto.Signer, error) {
+	s, err := decodeWithAD(c, priv, alg, AssociatedData(id, alg))
+	if err != nil && !errors.Is(err, ErrSealed) && !errors.Is(err, ErrUnsupportedAlgorithm) &&
+		!errors.Is(err, ErrDecrypt) {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	return s, err
+}
+
+func encodeWithAD(c MultiCodec, s crypto.Signer, alg string, ad []byte) ([]byte, error) {
+	if adc, ok := c.(AssociatedDataCodec); ok {
+		return adc.EncodeWithAD(s, alg, ad)
+	}
+	return c.Encode(s, alg)
+}
+
+func decodeWithAD(c MultiCodec, priv []byte, alg string, ad []byte) (crypto.Signer, error) {
+	if adc, ok := c.(AssociatedDataCodec); ok {
+		return adc.DecodeWithAD(priv, alg, ad)
+	}
+	return c.Decode(priv, alg)
+}
+
 type multiCodec struct {
 	Codecs map[string]Codec
 }
@@ -50,7 +119,7 @@ type multiCodec struct {
 func (c *multiCodec) Encode(k crypto.Signer, alg string) ([]byte, error) {
 	enc, ok := c.Codecs[alg]
 	if !ok {
-		return []byte{}, fmt.Errorf("algorithm '%s' is not supported by the codec", alg)
+		return []byte{}, fmt.Errorf("%w '%s' by the codec", ErrUnsupportedAlgorithm, alg)
 	}
 	return enc.Encode(k)
 }
@@ -58,7 +127,7 @@ func (c *multiCodec) Encode(k crypto.Signer, alg string) ([]byte, error) {
 func (c *multiCodec) Decode(priv []byte, alg string) (crypto.Signer, error) {
 	dec, ok := c.Codecs[alg]
 	if !ok {
-		return nil, fmt.Errorf("algorithm '%s' is not supported by the codec", alg)
+		return nil, fmt.Errorf("%w '%s' by the codec", ErrUnsupportedAlgorithm, alg)
 	}
 	return dec.Decode(priv)
 }
@@ -95,71 +164,397 @@ func (c *RsaGobCodec) Decode(priv []byte) (crypto.Signer, error) {
 	return &k, nil
 }
 
+//// ecdsa
+
+// EcdsaDerCodec implements the Codec interface for ECDSA Signers. It uses the SEC 1, ASN.1 DER
+// encoding.
+type EcdsaDerCodec struct{}
+
+// Encode serializes an ECDSA Signer to its DER encoding.
+func (c *EcdsaDerCodec) Encode(s crypto.Signer) ([]byte, error) {
+	k, ok := s.(*ecdsa.PrivateKey)
+	if !ok {
+		return []byte{}, fmt.Errorf("expected *ecdsa.PrivateKey but got %T", s)
+	}
+	return x509.MarshalECPrivateKey(k)
+}
+
+// Decode deserializes a DER encoded ECDSA private key to a Signer.
+func (c *EcdsaDerCodec) Decode(priv []byte) (crypto.Signer, error) {
+	return x509.ParseECPrivateKey(priv)
+}
+
+//// ed25519
+
+// Ed25519SeedCodec implements the Codec interface for Ed25519 Signers. The private key is
+// serialized as its RFC 8032 seed.
+type Ed25519SeedCodec struct{}
+
+// Encode serializes an Ed25519 Signer to its seed.
+func (c *Ed25519SeedCodec) Encode(s crypto.Signer) ([]byte, error) {
+	k, ok := s.(ed25519.PrivateKey)
+	if !ok {
+		return []byte{}, fmt.Errorf("expected ed25519.PrivateKey but got %T", s)
+	}
+	return k.Seed(), nil
+}
+
+// Decode deserializes an Ed25519 seed to a Signer.
+func (c *Ed25519SeedCodec) Decode(priv []byte) (crypto.Signer, error) {
+	if len(priv) != ed25519.SeedSize {
+		return nil, fmt.Errorf("expected ed25519 seed of %d bytes but got %d", ed25519.SeedSize, len(priv))
+	}
+	return ed25519.NewKeyFromSeed(priv), nil
+}
+
+//// secp256k1
+
+// Secp256k1Codec implements the Codec interface for `Secp256k1Signer`s. The private key is
+// serialized as its 32 byte big-endian scalar.
+type Secp256k1Codec struct{}
+
+// Encode serializes a `Secp256k1Signer` to its private scalar.
+func (c *Secp256k1Codec) Encode(s crypto.Signer) ([]byte, error) {
+	k, ok := s.(*Secp256k1Signer)
+	if !ok {
+		return []byte{}, fmt.Errorf("expected *key.Secp256k1Signer but got %T", s)
+	}
+	return k.key.Serialize(), nil
+}
+
+// Decode deserializes a private scalar to a `Secp256k1Signer`.
+func (c *Secp256k1Codec) Decode(priv []byte) (crypto.Signer, error) {
+	return newSecp256k1Signer(priv)
+}
+
 // encryption
 
 //// AES
 
+const (
+	// aesFormatVersion is the version of the ciphertext format written by `AesCodec`. Version 1
+	// ciphertexts are not bound to associated data.
+	aesFormatVersion   = 2
+	aesFormatVersionV1 = 1
+
+	// KDFs identify how the AES key is derived from the configured secret.
+	kdfLegacyMD5 = 0
+	kdfRaw       = 1
+	kdfArgon2id  = 2
+
+	aesKeySize   = 32
+	aesSaltSize  = 16
+	argon2Time   = 1
+	argon2Memory = 64 * 1024
+	argon2Thread = 4
+
+	// maxDerivedKeys caps the number of AES keys derived with Argon2id that are cached.
+	maxDerivedKeys = 16
+)
+
+// aesMarker prefixes ciphertexts written by `AesCodec` to distinguish them from the legacy format,
+// which had no header.
+var aesMarker = []byte{0xff, 'h', 'k', 'e'}
+
 // AesCodec implements the `MultiCodec` interface and can be added to any clear text `MultiCodec`
-// to provide AES encryption.
+// to provide AES-256-GCM encryption.
+//
+// Ciphertexts carry a header with the format version, the id of the KDF which derived the AES key
+// and its salt, followed by the nonce and the sealed data. Ciphertexts in the legacy format,
+// whose key was the MD5 hash of the passphrase, are still decrypted when the codec was created
+// from a passphrase. They are upgraded by encoding the decoded Signer again.
+//
+// AesCodec implements `AssociatedDataCodec`, so ciphertexts can be bound to the key they belong
+// to. Ciphertexts written before associated data was supported are decoded regardless of the
+// associated data, unless RequireAssociatedData is set.
+//
+// Keys derived with Argon2id are cached by salt. The salt used for encryption is adopted from the
+// first ciphertext the codec decrypts, such as the key check of a store, so that every process
+// sharing a store derives a single key. A random salt is only drawn if the codec encrypts first.
 type AesCodec struct {
-	key                 []byte
+	// RequireAssociatedData rejects ciphertexts which aren't bound to associated data. It should
+	// be set once all stored keys have been reencoded.
+	RequireAssociatedData bool
+
+	// kdf derives the key for encryption from the secret of the provider, which is either a
+	// passphrase or a raw key.
+	kdf      byte
+	provider KEKProvider
+
+	mu   sync.Mutex
+	salt []byte
+	keys map[string][]byte
+
 	clearTextMultiCodec MultiCodec
 }
 
-// NewAesCodec returns a new `MultiCodec` that wraps clearTextMultiCodec with encryption. The
-// provided key is used as the secret in all future encryptions.
+// NewAesCodec returns a new `MultiCodec` that wraps clearTextMultiCodec with encryption. The AES
+// key is derived from the passphrase key with Argon2id.
 func NewAesCodec(clearTextMultiCodec MultiCodec, key string) *AesCodec {
-	hasher := md5.New()
-	hasher.Write([]byte(key))
-	hKey := hasher.Sum(nil)
+	return NewAesCodecWithProvider(clearTextMultiCodec, StaticKEKProvider(key), false)
+}
+
+// NewAesCodecWithKey returns a new `MultiCodec` that wraps clearTextMultiCodec with encryption.
+// The provided 256-bit key is used as the AES key in all future encryptions.
+func NewAesCodecWithKey(clearTextMultiCodec MultiCodec, key []byte) (*AesCodec, error) {
+	if len(key) != aesKeySize {
+		return nil, fmt.Errorf("AES key must be %d bytes but got %d", aesKeySize, len(key))
+	}
+	return NewAesCodecWithProvider(clearTextMultiCodec, StaticKEKProvider(key), true), nil
+}
+
+// NewAesCodecWithProvider returns a new `MultiCodec` that wraps clearTextMultiCodec with
+// encryption. The secret is requested from provider when needed. If raw is set, the secret must
+// be a 256-bit key which is used as the AES key. Otherwise, the AES key is derived from the secret
+// with Argon2id.
+func NewAesCodecWithProvider(clearTextMultiCodec MultiCodec, provider KEKProvider, raw bool) *AesCodec {
+	if raw {
+		return &AesCodec{
+			kdf:                 kdfRaw,
+			provider:            provider,
+			clearTextMultiCodec: clearTextMultiCodec,
+		}
+	}
 
 	return &AesCodec{
-		key:                 hKey,
+		kdf:                 kdfArgon2id,
+		provider:            provider,
+		keys:                make(map[string][]byte),
 		clearTextMultiCodec: clearTextMultiCodec,
 	}
 }
 
+// deriveKey returns the AES key derived by kdf using salt.
+func (c *AesCodec) deriveKey(kdf byte, salt []byte) ([]byte, error) {
+	switch kdf {
+	case kdfRaw:
+		if c.kdf != kdfRaw {
+			return nil, errors.New("ciphertext requires a raw key but the codec has a passphrase")
+		}
+	case kdfLegacyMD5, kdfArgon2id:
+		if c.kdf == kdfRaw {
+			return nil, errors.New("ciphertext requires a passphrase but the codec has a raw key")
+		}
+	default:
+		return nil, fmt.Errorf("unknown KDF %d", kdf)
+	}
+
+	secret, err := c.provider.KEK()
+	if err != nil {
+		return nil, err
+	}
+
+	switch kdf {
+	case kdfRaw:
+		if len(secret) != aesKeySize {
+			return nil, fmt.Errorf("AES key must be %d bytes but got %d", aesKeySize, len(secret))
+		}
+		return secret, nil
+	case kdfLegacyMD5:
+		h := md5.Sum(secret)
+		return h[:], nil
+	}
+
+	// Keys are cached by the secret as well as the salt, since the secret of a provider can
+	// change, such as when it is unsealed with different shares.
+	h := sha256.Sum256(secret)
+	id := string(append(h[:], salt...))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if k, ok := c.keys[id]; ok {
+		return k, nil
+	}
+	if len(c.keys) >= maxDerivedKeys {
+		for other := range c.keys {
+			delete(c.keys, other)
+			break
+		}
+	}
+	k := argon2.IDKey(secret, salt, argon2Time, argon2Memory, argon2Thread, aesKeySize)
+	c.keys[id] = k
+	return k, nil
+}
+
+// encryptionSalt returns the salt used for encryption, drawing a random one if the codec hasn't
+// adopted a salt yet.
+func (c *AesCodec) encryptionSalt() ([]byte, error) {
+	if c.kdf != kdfArgon2id {
+		return nil, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.salt == nil {
+		salt := make([]byte, aesSaltSize)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, err
+		}
+		c.salt = salt
+	}
+	return c.salt, nil
+}
+
+// adoptSalt makes salt the salt used for encryption, unless the codec already has one.
+func (c *AesCodec) adoptSalt(salt []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.salt == nil {
+		c.salt = append([]byte{}, salt...)
+	}
+}
+
+// clearKeys discards every AES key derived from the secret.
+func (c *AesCodec) clearKeys() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys != nil {
+		c.keys = make(map[string][]byte)
+	}
+}
+
 // Encode serializes and encrypts s.
 func (c *AesCodec) Encode(s crypto.Signer, alg string) ([]byte, error) {
+	return c.EncodeWithAD(s, alg, nil)
+}
+
+// EncodeWithAD serializes and encrypts s, binding the ciphertext to the associated data ad.
+func (c *AesCodec) EncodeWithAD(s crypto.Signer, alg string, ad []byte) ([]byte, error) {
 	priv, err := c.clearTextMultiCodec.Encode(s, alg)
 	if err != nil {
 		return []byte{}, err
 	}
 
-	block, err := aes.NewCipher(c.key)
+	salt, err := c.encryptionSalt()
 	if err != nil {
 		return []byte{}, err
 	}
-	gcm, err := cipher.NewGCM(block)
+	key, err := c.deriveKey(c.kdf, salt)
 	if err != nil {
 		return []byte{}, err
 	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	header := append([]byte{}, aesMarker...)
+	header = append(header, aesFormatVersion, c.kdf, byte(len(salt)))
+	header = append(header, salt...)
 
 	nonce := make([]byte, gcm.NonceSize())
 	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
 		return []byte{}, err
 	}
-	ciphertext := gcm.Seal(nonce, nonce, priv, nil)
+	out := append(append([]byte{}, header...), nonce...)
+	ciphertext := gcm.Seal(out, nonce, priv, append(header, ad...))
 	return ciphertext, nil
 }
 
 // Decode decrypts and deserializes the private key contained in data.
 func (c *AesCodec) Decode(data []byte, alg string) (crypto.Signer, error) {
-	block, err := aes.NewCipher(c.key)
+	return c.DecodeWithAD(data, alg, nil)
+}
+
+// DecodeWithAD decrypts and deserializes the private key contained in data, which must be bound
+// to the associated data ad.
+func (c *AesCodec) DecodeWithAD(data []byte, alg string, ad []byte) (crypto.Signer, error) {
+	priv, err := c.open(data, ad)
+	if err != nil && !c.RequireAssociatedData {
+		// Legacy ciphertexts have no header, but may begin with the marker by chance.
+		var lerr error
+		if priv, lerr = c.openLegacy(data); lerr == nil {
+			err = nil
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
-	gcm, err := cipher.NewGCM(block)
+
+	return c.clearTextMultiCodec.Decode(priv, alg)
+}
+
+// open decrypts data in the current or version 1 format.
+func (c *AesCodec) open(data, ad []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, aesMarker) || len(data) < len(aesMarker)+3 {
+		return nil, errors.New("ciphertext has no header")
+	}
+	h := data[len(aesMarker):]
+	version, kdf, saltSize := h[0], h[1], int(h[2])
+	switch version {
+	case aesFormatVersion:
+	case aesFormatVersionV1:
+		if c.RequireAssociatedData {
+			return nil, errors.New("ciphertext is not bound to associated data")
+		}
+	default:
+		return nil, fmt.Errorf("unknown ciphertext format version %d", version)
+	}
+	if len(h) < 3+saltSize {
+		return nil, errors.New("ciphertext is too short")
+	}
+	salt := h[3 : 3+saltSize]
+	header, rest := data[:len(aesMarker)+3+saltSize], h[3+saltSize:]
+
+	key, err := c.deriveKey(kdf, salt)
+	if err != nil {
+		return nil, err
+	}
+	if version == aesFormatVersionV1 {
+		ad = nil
+	}
+	priv, err := gcmOpen(key, rest, append(append([]byte{}, header...), ad...))
+	if err != nil {
+		return nil, err
+	}
+	if kdf == kdfArgon2id {
+		c.adoptSalt(salt)
+	}
+	return priv, nil
+}
+
+// openLegacy decrypts data in the legacy format, which has no header.
+func (c *AesCodec) openLegacy(data []byte) ([]byte, error) {
+	key, err := c.deriveKey(kdfLegacyMD5, nil)
+	if err != nil {
+		return nil, err
+	}
+	return gcmOpen(key, data, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// gcmOpen decrypts data prefixed by its nonce.
+func gcmOpen(key, data, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
 		return nil, err
 	}
 
 	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize {
+		return nil, errors.New("ciphertext is too short")
+	}
 	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
-	priv, err := gcm.Open(nil, nonce, ciphertext, nil)
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// gcmSeal encrypts plaintext and appends the nonce followed by the ciphertext to dst.
+func gcmSeal(key, dst, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.clearTextMultiCodec.Decode(priv, alg)
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(append(dst, nonce...), nonce, plaintext, additionalData), nil
 }
@@ -0,0 +1,232 @@
+package key
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/md5"
+	"crypto/rand"
+	"testing"
+)
+
+const testPassphrase = "correct horse battery staple"
+
+func newTestSigner(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+func assertSameKey(t *testing.T, got crypto.Signer, want ed25519.PrivateKey) {
+	t.Helper()
+	pub, ok := got.Public().(ed25519.PublicKey)
+	if !ok || !bytes.Equal(pub, want.Public().(ed25519.PublicKey)) {
+		t.Fatalf("decoded a different key")
+	}
+}
+
+// encodeClearText encodes s with the clear text codec wrapped by `AesCodec`s in these tests.
+func encodeClearText(t *testing.T, s crypto.Signer) []byte {
+	t.Helper()
+	priv, err := DefaultCodec.Encode(s, ED25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+func TestAesCodecDecodeLegacy(t *testing.T) {
+	s := newTestSigner(t)
+	// Legacy ciphertexts are the nonce and sealed data, using the MD5 hash of the passphrase.
+	key := md5.Sum([]byte(testPassphrase))
+	data, err := gcmSeal(key[:], nil, encodeClearText(t, s), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewAesCodec(DefaultCodec, testPassphrase)
+	got, err := c.DecodeWithAD(data, ED25519, AssociatedData("id", ED25519))
+	if err != nil {
+		t.Fatalf("DecodeWithAD() error = %v", err)
+	}
+	assertSameKey(t, got, s)
+
+	c.RequireAssociatedData = true
+	if _, err := c.DecodeWithAD(data, ED25519, AssociatedData("id", ED25519)); err == nil {
+		t.Fatal("DecodeWithAD() with RequireAssociatedData decoded a legacy ciphertext")
+	}
+}
+
+func TestAesCodecDecodeV1(t *testing.T) {
+	s := newTestSigner(t)
+	c := NewAesCodec(DefaultCodec, testPassphrase)
+	salt := make([]byte, aesSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		t.Fatal(err)
+	}
+	key, err := c.deriveKey(kdfArgon2id, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Version 1 ciphertexts only authenticate their header.
+	header := append([]byte{}, aesMarker...)
+	header = append(header, aesFormatVersionV1, kdfArgon2id, byte(len(salt)))
+	header = append(header, salt...)
+	data, err := gcmSeal(key, append([]byte{}, header...), encodeClearText(t, s), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.DecodeWithAD(data, ED25519, AssociatedData("id", ED25519))
+	if err != nil {
+		t.Fatalf("DecodeWithAD() error = %v", err)
+	}
+	assertSameKey(t, got, s)
+
+	c.RequireAssociatedData = true
+	if _, err := c.DecodeWithAD(data, ED25519, AssociatedData("id", ED25519)); err == nil {
+		t.Fatal("DecodeWithAD() with RequireAssociatedData decoded a version 1 ciphertext")
+	}
+}
+
+func TestAesCodecDecodeV2(t *testing.T) {
+	s := newTestSigner(t)
+	for name, c := range map[string]*AesCodec{
+		"passphrase": NewAesCodec(DefaultCodec, testPassphrase),
+		"raw":        newRawAesCodec(t),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ad := AssociatedData("id", ED25519)
+			data, err := c.EncodeWithAD(s, ED25519, ad)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(data, aesMarker) || data[len(aesMarker)] != aesFormatVersion {
+				t.Fatalf("EncodeWithAD() didn't write a version %d header", aesFormatVersion)
+			}
+
+			c.RequireAssociatedData = true
+			got, err := c.DecodeWithAD(data, ED25519, ad)
+			if err != nil {
+				t.Fatalf("DecodeWithAD() error = %v", err)
+			}
+			assertSameKey(t, got, s)
+		})
+	}
+}
+
+func TestAesCodecSharedSalt(t *testing.T) {
+	s := newTestSigner(t)
+	ad := AssociatedData("id", ED25519)
+	a := NewAesCodec(DefaultCodec, testPassphrase)
+	b := NewAesCodec(DefaultCodec, testPassphrase)
+
+	data, err := a.EncodeWithAD(s, ED25519, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.DecodeWithAD(data, ED25519, ad)
+	if err != nil {
+		t.Fatalf("DecodeWithAD() error = %v", err)
+	}
+	assertSameKey(t, got, s)
+
+	// b adopted the salt of a, so it encrypts with the key it already derived.
+	data, err = b.EncodeWithAD(s, ED25519, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = a.DecodeWithAD(data, ED25519, ad)
+	if err != nil {
+		t.Fatalf("DecodeWithAD() error = %v", err)
+	}
+	assertSameKey(t, got, s)
+
+	for name, c := range map[string]*AesCodec{"a": a, "b": b} {
+		if n := len(c.keys); n != 1 {
+			t.Errorf("codec %s derived %d keys, want 1", name, n)
+		}
+	}
+}
+
+func TestAesCodecDerivedKeysCapped(t *testing.T) {
+	c := NewAesCodec(DefaultCodec, testPassphrase)
+	for i := 0; i < maxDerivedKeys+2; i++ {
+		if _, err := c.deriveKey(kdfArgon2id, []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(c.keys); n != maxDerivedKeys {
+		t.Errorf("codec cached %d keys, want %d", n, maxDerivedKeys)
+	}
+}
+
+func TestAesCodecAssociatedDataMismatch(t *testing.T) {
+	s := newTestSigner(t)
+	c := newRawAesCodec(t)
+	data, err := c.EncodeWithAD(s, ED25519, AssociatedData("id", ED25519))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ad := range [][]byte{
+		AssociatedData("other", ED25519),
+		AssociatedData("id", ECDSA),
+		nil,
+	} {
+		if _, err := c.DecodeWithAD(data, ED25519, ad); err == nil {
+			t.Errorf("DecodeWithAD() decoded with associated data %q", ad)
+		}
+	}
+}
+
+func TestAesCodecDecodeMalformed(t *testing.T) {
+	s := newTestSigner(t)
+	c := newRawAesCodec(t)
+	ad := AssociatedData("id", ED25519)
+	data, err := c.EncodeWithAD(s, ED25519, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 0; n < len(data); n++ {
+		if _, err := c.DecodeWithAD(data[:n], ED25519, ad); err == nil {
+			t.Errorf("DecodeWithAD() decoded a ciphertext truncated to %d bytes", n)
+		}
+	}
+
+	garbage := [][]byte{
+		nil,
+		{0xff},
+		[]byte("not a ciphertext"),
+		append(append([]byte{}, aesMarker...), 0xff, 0xff, 0xff),
+		append(append([]byte{}, aesMarker...), aesFormatVersion, kdfRaw, 0xff),
+		append(append([]byte{}, aesMarker...), aesFormatVersion, 0x7f, 0),
+	}
+	random := make([]byte, 128)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	garbage = append(garbage, random)
+	for _, g := range garbage {
+		if _, err := c.DecodeWithAD(g, ED25519, ad); err == nil {
+			t.Errorf("DecodeWithAD() decoded garbage %x", g)
+		}
+	}
+}
+
+func newRawAesCodec(t *testing.T) *AesCodec {
+	t.Helper()
+	key := make([]byte, aesKeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewAesCodecWithKey(DefaultCodec, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
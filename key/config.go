@@ -1,6 +1,9 @@
 package key
 
 import (
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 )
@@ -11,15 +14,127 @@ const (
 
 	// RSA the signing algorithm
 	RSA = "rsa"
+	// ECDSA the signing algorithm
+	ECDSA = "ecdsa"
+	// ED25519 the signing algorithm
+	ED25519 = "ed25519"
+	// SECP256K1 the signing algorithm
+	SECP256K1 = "secp256k1"
 
 	// AES the encryption algorithm
 	AES = "aes"
+	// Envelope the encryption algorithm, which encrypts every key with its own AES data key
+	Envelope = "envelope"
+
+	// Argon2id derives the AES key from a passphrase. It is the default KDF.
+	Argon2id = "argon2id"
+	// RawKey uses the hex encoded, 256-bit key as the AES key.
+	RawKey = "raw"
+
+	// ConfigProvider reads secrets from the config. It is the default KEK provider.
+	ConfigProvider = "config"
+	// EnvProvider reads secrets from an environment variable.
+	EnvProvider = "env"
+	// FileProvider reads secrets from a file.
+	FileProvider = "file"
+	// CommandProvider reads secrets from the output of an external command.
+	CommandProvider = "command"
+	// ShamirProvider starts sealed until operators submit enough Shamir shares of the secret.
+	ShamirProvider = "shamir"
 )
 
 // Config provides configuration for KeyStorage.
 type Config struct {
 	Encryption string `json:"encryption"`
 	Key        string `json:"key"`
+	// KeyProvider optionally selects where the secret is read from instead of Key.
+	KeyProvider *KEKProviderConfig `json:"key_provider"`
+	// KDF specifies how the AES key is derived from Key. See this file's constants for options.
+	KDF string `json:"kdf"`
+	// RequireAssociatedData rejects encrypted keys which aren't bound to their id and algorithm.
+	// It should be enabled once keys stored by earlier versions have been reencoded.
+	RequireAssociatedData bool `json:"require_associated_data"`
+	// Keyring holds the key-encryption keys of envelope encryption. If Key is also set, keys
+	// encrypted by AES are still decrypted with it.
+	Keyring KeyringConfig `json:"keyring"`
+}
+
+// KeyringConfig provides configuration for a `Keyring`.
+type KeyringConfig struct {
+	// Primary is the ID of the key-encryption key which wraps new data keys.
+	Primary string `json:"primary"`
+	// Keys are the hex encoded, 256-bit key-encryption keys by ID.
+	Keys map[string]string `json:"keys"`
+	// Providers optionally select where the key-encryption keys are read from by ID, in addition
+	// to Keys. The secrets they provide must also be hex encoded.
+	Providers map[string]KEKProviderConfig `json:"providers"`
+}
+
+// GetKeyring returns the `Keyring` of the config.
+func (c *KeyringConfig) GetKeyring() (*Keyring, error) {
+	keks := make(map[string]KEKProvider, len(c.Keys)+len(c.Providers))
+	for id, k := range c.Keys {
+		kek, err := hex.DecodeString(k)
+		if err != nil {
+			return nil, fmt.Errorf("KEK '%s' must be hex encoded: %v", id, err)
+		}
+		keks[id] = StaticKEKProvider(kek)
+	}
+	for id, pc := range c.Providers {
+		if _, dup := keks[id]; dup {
+			return nil, fmt.Errorf("KEK '%s' is configured twice", id)
+		}
+		p, err := pc.GetProvider()
+		if err != nil {
+			return nil, err
+		}
+		keks[id] = &HexKEKProvider{p}
+	}
+	return NewKeyring(c.Primary, keks)
+}
+
+// KEKProviderConfig provides configuration for a `KEKProvider`.
+type KEKProviderConfig struct {
+	// Type selects the provider. See this file's constants for options.
+	Type string `json:"type"`
+	// Value is the secret of the config provider.
+	Value string `json:"value"`
+	// Env is the environment variable of the env provider. It defaults to HANCOCK_KEY.
+	Env string `json:"env"`
+	// Path is the file of the file provider.
+	Path string `json:"path"`
+	// Command is the command and arguments of the command provider.
+	Command []string `json:"command"`
+	// Threshold is the number of shares required to unseal the shamir provider.
+	Threshold int `json:"threshold"`
+}
+
+// GetProvider returns the `KEKProvider` selected by the config's Type.
+func (c *KEKProviderConfig) GetProvider() (KEKProvider, error) {
+	switch c.Type {
+	case "", ConfigProvider:
+		return StaticKEKProvider(c.Value), nil
+	case EnvProvider:
+		name := c.Env
+		if name == "" {
+			name = EnvKey
+		}
+		return &EnvKEKProvider{Name: name}, nil
+	case FileProvider:
+		if c.Path == "" {
+			return nil, errors.New("file KEK provider requires a path")
+		}
+		return &FileKEKProvider{Path: c.Path}, nil
+	case CommandProvider:
+		if len(c.Command) == 0 {
+			return nil, errors.New("command KEK provider requires a command")
+		}
+		return &CommandKEKProvider{Command: c.Command}, nil
+	case ShamirProvider:
+		return NewShamirKEKProvider(c.Threshold)
+	default:
+		return nil, fmt.Errorf("KEK provider '%s' is not supported", c.Type)
+	}
 }
 
 // LoadEnv replaces empty fields with matching environment variables. See this file's
@@ -33,13 +148,59 @@ func (c *Config) LoadEnv() {
 }
 
 // GetCodec returns builtin `MultiCodec`s according to the config's Encryption.
-func (c *Config) GetCodec() MultiCodec {
+func (c *Config) GetCodec() (MultiCodec, error) {
 	switch c.Encryption {
 	case AES:
 		log.Print("hancock: added AES encryption")
-		return NewAesCodec(DefaultCodec, c.Key)
+		return c.getAesCodec()
+	case Envelope:
+		log.Print("hancock: added envelope encryption")
+		return c.getEnvelopeCodec()
 	default:
 		log.Print("hancock: no encryption enabled")
-		return DefaultCodec
+		return DefaultCodec, nil
+	}
+}
+
+// getKeyProvider returns the `KEKProvider` of the AES secret.
+func (c *Config) getKeyProvider() (KEKProvider, error) {
+	if c.KeyProvider == nil {
+		return StaticKEKProvider(c.Key), nil
+	}
+	return c.KeyProvider.GetProvider()
+}
+
+func (c *Config) getAesCodec() (*AesCodec, error) {
+	provider, err := c.getKeyProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	var codec *AesCodec
+	switch c.KDF {
+	case "", Argon2id:
+		codec = NewAesCodecWithProvider(DefaultCodec, provider, false)
+	case RawKey:
+		codec = NewAesCodecWithProvider(DefaultCodec, &HexKEKProvider{provider}, true)
+	default:
+		return nil, fmt.Errorf("KDF '%s' is not supported", c.KDF)
+	}
+
+	codec.RequireAssociatedData = c.RequireAssociatedData
+	return codec, nil
+}
+
+func (c *Config) getEnvelopeCodec() (*EnvelopeCodec, error) {
+	keyring, err := c.Keyring.GetKeyring()
+	if err != nil {
+		return nil, err
+	}
+	codec := NewEnvelopeCodec(DefaultCodec, keyring)
+
+	if c.Key != "" || c.KeyProvider != nil {
+		if codec.Fallback, err = c.getAesCodec(); err != nil {
+			return nil, err
+		}
 	}
+	return codec, nil
 }
@@ -0,0 +1,54 @@
+package key
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultDeletionWaitingPeriod is how long a key scheduled for deletion can be restored, if
+	// no waiting period is given.
+	DefaultDeletionWaitingPeriod = 30 * 24 * time.Hour
+	// MinDeletionWaitingPeriod is the shortest waiting period before a key is destroyed.
+	MinDeletionWaitingPeriod = 24 * time.Hour
+	// MaxDeletionWaitingPeriod is the longest waiting period before a key is destroyed.
+	MaxDeletionWaitingPeriod = 90 * 24 * time.Hour
+)
+
+// GetWaitingPeriod returns the waiting period before a key scheduled for deletion is destroyed.
+// A zero waitingPeriod defaults to `DefaultDeletionWaitingPeriod`. Otherwise, it must be between
+// `MinDeletionWaitingPeriod` and `MaxDeletionWaitingPeriod`, or the error wraps
+// `ErrInvalidWaitingPeriod`.
+func GetWaitingPeriod(waitingPeriod time.Duration) (time.Duration, error) {
+	if waitingPeriod == 0 {
+		return DefaultDeletionWaitingPeriod, nil
+	}
+	if waitingPeriod < MinDeletionWaitingPeriod || waitingPeriod > MaxDeletionWaitingPeriod {
+		return 0, fmt.Errorf("%w: must be between %s and %s", ErrInvalidWaitingPeriod,
+			MinDeletionWaitingPeriod, MaxDeletionWaitingPeriod)
+	}
+	return waitingPeriod, nil
+}
+
+// PendingDeletion reports whether the key is scheduled for deletion.
+func (k *Key) PendingDeletion() bool {
+	return k.DeletionTime != nil
+}
+
+// ScheduleDeletion sets the deletion time of the key to waitingPeriod from now, as validated by
+// `GetWaitingPeriod`. The error wraps `ErrPendingDeletion` if the key is already scheduled for
+// deletion.
+func (k *Key) ScheduleDeletion(waitingPeriod time.Duration) error {
+	waitingPeriod, err := GetWaitingPeriod(waitingPeriod)
+	if err != nil {
+		return err
+	}
+	if k.PendingDeletion() {
+		return fmt.Errorf("%w: key '%s' will be destroyed at %s", ErrPendingDeletion, k.ID,
+			k.DeletionTime.Format(time.RFC3339))
+	}
+
+	deletionTime := time.Now().UTC().Truncate(time.Microsecond).Add(waitingPeriod)
+	k.DeletionTime = &deletionTime
+	return nil
+}
@@ -0,0 +1,235 @@
+package key
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// envelopeFormatVersion is the version of the ciphertext format written by `EnvelopeCodec`.
+	envelopeFormatVersion = 1
+
+	dekSize = 32
+)
+
+// envelopeMarker prefixes ciphertexts written by `EnvelopeCodec`.
+var envelopeMarker = []byte{0xff, 'h', 'k', 'v'}
+
+// Keyring holds 256-bit key-encryption keys (KEKs) by their ID.
+type Keyring struct {
+	// Primary is the ID of the KEK which wraps new data keys.
+	Primary string
+	// KEKs provide the key-encryption keys by ID. Data keys wrapped by a KEK can only be
+	// unwrapped while it is in the keyring.
+	KEKs map[string]KEKProvider
+}
+
+// NewKeyring returns a `Keyring` of the keks where primary identifies the KEK wrapping new data
+// keys.
+func NewKeyring(primary string, keks map[string]KEKProvider) (*Keyring, error) {
+	if _, ok := keks[primary]; !ok {
+		return nil, fmt.Errorf("primary KEK '%s' is not in the keyring", primary)
+	}
+	for id := range keks {
+		if len(id) > 255 {
+			return nil, fmt.Errorf("KEK id '%s' is longer than 255 bytes", id)
+		}
+	}
+	return &Keyring{primary, keks}, nil
+}
+
+func (r *Keyring) get(id string) ([]byte, error) {
+	p, ok := r.KEKs[id]
+	if !ok {
+		return nil, fmt.Errorf("KEK '%s' is not in the keyring", id)
+	}
+	kek, err := p.KEK()
+	if err != nil {
+		return nil, err
+	}
+	if len(kek) != aesKeySize {
+		return nil, fmt.Errorf("KEK '%s' must be %d bytes but got %d", id, aesKeySize, len(kek))
+	}
+	return kek, nil
+}
+
+// EnvelopeCodec implements the `AssociatedDataCodec` interface using envelope encryption. Every
+// Signer is encrypted with its own random data-encryption key (DEK), which is wrapped by a KEK
+// from the `Keyring`.
+//
+// Ciphertexts carry a header with the format version, the ID of the KEK and the wrapped DEK,
+// followed by the nonce and the sealed data. Since the DEK is wrapped separately, it can be
+// rewrapped by a new KEK without decrypting the Signer. See `EnvelopeCodec.Rewrap`.
+type EnvelopeCodec struct {
+	keyring             *Keyring
+	clearTextMultiCodec MultiCodec
+
+	// Fallback optionally decodes ciphertexts written before envelope encryption was enabled,
+	// such as those of an `AesCodec`. They are upgraded by encoding the decoded Signer again.
+	Fallback MultiCodec
+}
+
+// NewEnvelopeCodec returns a new `MultiCodec` that wraps clearTextMultiCodec with envelope
+// encryption using the KEKs in keyring.
+func NewEnvelopeCodec(clearTextMultiCodec MultiCodec, keyring *Keyring) *EnvelopeCodec {
+	return &EnvelopeCodec{
+		keyring:             keyring,
+		clearTextMultiCodec: clearTextMultiCodec,
+	}
+}
+
+// envelope is a parsed `EnvelopeCodec` ciphertext.
+type envelope struct {
+	kekID      string
+	wrappedDEK []byte
+	sealed     []byte
+}
+
+func (e *envelope) marshal() []byte {
+	b := append([]byte{}, envelopeMarker...)
+	b = append(b, envelopeFormatVersion, byte(len(e.kekID)))
+	b = append(b, e.kekID...)
+	b = append(b, byte(len(e.wrappedDEK)))
+	b = append(b, e.wrappedDEK...)
+	return append(b, e.sealed...)
+}
+
+func parseEnvelope(data []byte) (*envelope, error) {
+	if !bytes.HasPrefix(data, envelopeMarker) {
+		return nil, fmt.Errorf("%w: ciphertext has no envelope header", ErrNotEnvelope)
+	}
+	b := data[len(envelopeMarker):]
+	if len(b) < 2 {
+		return nil, errors.New("ciphertext is too short")
+	}
+	if b[0] != envelopeFormatVersion {
+		return nil, fmt.Errorf("unknown envelope format version %d", b[0])
+	}
+
+	var e envelope
+	n := int(b[1])
+	b = b[2:]
+	if len(b) < n+1 {
+		return nil, errors.New("ciphertext is too short")
+	}
+	e.kekID, b = string(b[:n]), b[n:]
+
+	n = int(b[0])
+	b = b[1:]
+	if len(b) < n {
+		return nil, errors.New("ciphertext is too short")
+	}
+	e.wrappedDEK, e.sealed = b[:n], b[n:]
+	return &e, nil
+}
+
+// dekAD binds a wrapped DEK to the KEK which wrapped it.
+func dekAD(kekID string) []byte {
+	return append(append([]byte{}, envelopeMarker...), kekID...)
+}
+
+// sealedAD binds the sealed Signer to the envelope format and the associated data ad. It doesn't
+// include the KEK, which changes when the DEK is rewrapped.
+func sealedAD(ad []byte) []byte {
+	b := append([]byte{}, envelopeMarker...)
+	b = append(b, envelopeFormatVersion)
+	return append(b, ad...)
+}
+
+func (c *EnvelopeCodec) wrap(kekID string, dek []byte) ([]byte, error) {
+	kek, err := c.keyring.get(kekID)
+	if err != nil {
+		return nil, err
+	}
+	return gcmSeal(kek, nil, dek, dekAD(kekID))
+}
+
+func (c *EnvelopeCodec) unwrap(e *envelope) ([]byte, error) {
+	kek, err := c.keyring.get(e.kekID)
+	if err != nil {
+		return nil, err
+	}
+	return gcmOpen(kek, e.wrappedDEK, dekAD(e.kekID))
+}
+
+// Encode serializes and encrypts s.
+func (c *EnvelopeCodec) Encode(s crypto.Signer, alg string) ([]byte, error) {
+	return c.EncodeWithAD(s, alg, nil)
+}
+
+// EncodeWithAD serializes and encrypts s with a new DEK, binding the ciphertext to the associated
+// data ad. The DEK is wrapped by the primary KEK.
+func (c *EnvelopeCodec) EncodeWithAD(s crypto.Signer, alg string, ad []byte) ([]byte, error) {
+	priv, err := c.clearTextMultiCodec.Encode(s, alg)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	dek := make([]byte, dekSize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return []byte{}, err
+	}
+
+	e := envelope{kekID: c.keyring.Primary}
+	if e.wrappedDEK, err = c.wrap(e.kekID, dek); err != nil {
+		return []byte{}, err
+	}
+	if e.sealed, err = gcmSeal(dek, nil, priv, sealedAD(ad)); err != nil {
+		return []byte{}, err
+	}
+	return e.marshal(), nil
+}
+
+// Decode decrypts and deserializes the private key contained in data.
+func (c *EnvelopeCodec) Decode(data []byte, alg string) (crypto.Signer, error) {
+	return c.DecodeWithAD(data, alg, nil)
+}
+
+// DecodeWithAD decrypts and deserializes the private key contained in data, which must be bound
+// to the associated data ad. Data which isn't an envelope is decoded by the Fallback.
+func (c *EnvelopeCodec) DecodeWithAD(data []byte, alg string, ad []byte) (crypto.Signer, error) {
+	e, err := parseEnvelope(data)
+	if err != nil {
+		if c.Fallback == nil {
+			return nil, err
+		}
+		return decodeWithAD(c.Fallback, data, alg, ad)
+	}
+
+	dek, err := c.unwrap(e)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := gcmOpen(dek, e.sealed, sealedAD(ad))
+	if err != nil {
+		return nil, err
+	}
+	return c.clearTextMultiCodec.Decode(priv, alg)
+}
+
+// Rewrap rewraps the DEK of the ciphertext data with the primary KEK, without decrypting the
+// Signer. It reports whether data had to be rewrapped, which is not the case if it was already
+// wrapped by the primary KEK. If data isn't an envelope, the error wraps `ErrNotEnvelope`.
+func (c *EnvelopeCodec) Rewrap(data []byte) ([]byte, bool, error) {
+	e, err := parseEnvelope(data)
+	if err != nil {
+		return nil, false, err
+	}
+	if e.kekID == c.keyring.Primary {
+		return data, false, nil
+	}
+
+	dek, err := c.unwrap(e)
+	if err != nil {
+		return nil, false, err
+	}
+	e.kekID = c.keyring.Primary
+	if e.wrappedDEK, err = c.wrap(e.kekID, dek); err != nil {
+		return nil, false, err
+	}
+	return e.marshal(), true, nil
+}
@@ -0,0 +1,93 @@
+package key
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func newTestKEK(t *testing.T) KEKProvider {
+	t.Helper()
+	kek := make([]byte, aesKeySize)
+	if _, err := rand.Read(kek); err != nil {
+		t.Fatal(err)
+	}
+	return StaticKEKProvider(kek)
+}
+
+func newTestKeyring(t *testing.T, primary string, keks map[string]KEKProvider) *Keyring {
+	t.Helper()
+	r, err := NewKeyring(primary, keks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestEnvelopeCodecRewrap(t *testing.T) {
+	s := newTestSigner(t)
+	ad := AssociatedData("id", ED25519)
+	old, next := newTestKEK(t), newTestKEK(t)
+
+	c := NewEnvelopeCodec(DefaultCodec, newTestKeyring(t, "old", map[string]KEKProvider{"old": old}))
+	data, err := c.EncodeWithAD(s, ED25519, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The KEK changes, but the old KEK is kept until every DEK has been rewrapped.
+	c = NewEnvelopeCodec(DefaultCodec, newTestKeyring(t, "next", map[string]KEKProvider{
+		"old":  old,
+		"next": next,
+	}))
+	rewrapped, ok, err := c.Rewrap(data)
+	if err != nil {
+		t.Fatalf("Rewrap() error = %v", err)
+	}
+	if !ok {
+		t.Fatal("Rewrap() didn't rewrap a DEK wrapped by the old KEK")
+	}
+	e, err := parseEnvelope(rewrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.kekID != "next" {
+		t.Fatalf("Rewrap() wrapped the DEK with KEK '%s'", e.kekID)
+	}
+	if _, ok, err := c.Rewrap(rewrapped); err != nil || ok {
+		t.Fatalf("Rewrap() of a rewrapped DEK = %v, %v", ok, err)
+	}
+
+	// Once rewrapped, the old KEK is no longer needed.
+	c = NewEnvelopeCodec(DefaultCodec, newTestKeyring(t, "next", map[string]KEKProvider{"next": next}))
+	got, err := c.DecodeWithAD(rewrapped, ED25519, ad)
+	if err != nil {
+		t.Fatalf("DecodeWithAD() error = %v", err)
+	}
+	assertSameKey(t, got, s)
+	if _, err := c.DecodeWithAD(data, ED25519, ad); err == nil {
+		t.Fatal("DecodeWithAD() decoded a DEK wrapped by a KEK which isn't in the keyring")
+	}
+}
+
+func TestEnvelopeCodecDecodeMalformed(t *testing.T) {
+	s := newTestSigner(t)
+	ad := AssociatedData("id", ED25519)
+	c := NewEnvelopeCodec(DefaultCodec, newTestKeyring(t, "kek", map[string]KEKProvider{"kek": newTestKEK(t)}))
+	data, err := c.EncodeWithAD(s, ED25519, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.DecodeWithAD(data, ED25519, AssociatedData("other", ED25519)); err == nil {
+		t.Error("DecodeWithAD() decoded with the wrong associated data")
+	}
+	for n := 0; n < len(data); n++ {
+		if _, err := c.DecodeWithAD(data[:n], ED25519, ad); err == nil {
+			t.Errorf("DecodeWithAD() decoded a ciphertext truncated to %d bytes", n)
+		}
+	}
+	if _, _, err := c.Rewrap([]byte("not an envelope")); !errors.Is(err, ErrNotEnvelope) {
+		t.Errorf("Rewrap() of garbage error = %v, want ErrNotEnvelope", err)
+	}
+}
@@ -0,0 +1,58 @@
+package key
+
+import "errors"
+
+var (
+	// ErrNotFound is returned by a `Storage` when no key exists with the requested id.
+	ErrNotFound = errors.New("hancock: key not found")
+	// ErrInvalidID is returned by a `Storage` when the requested id can't identify any key, such
+	// as an id which isn't a valid uuid.
+	ErrInvalidID = errors.New("hancock: invalid key id")
+	// ErrInvalidListOptions is returned when listing keys with a malformed cursor or an out of
+	// bounds limit.
+	ErrInvalidListOptions = errors.New("hancock: invalid list options")
+	// ErrDisabled is returned when signing with a disabled key.
+	ErrDisabled = errors.New("hancock: key is disabled")
+	// ErrCompromised is returned when signing with a compromised key.
+	ErrCompromised = errors.New("hancock: key is compromised")
+	// ErrNotYetValid is returned when signing with a key before its not before time.
+	ErrNotYetValid = errors.New("hancock: key is not yet valid")
+	// ErrExpired is returned when signing with a key after its not after time.
+	ErrExpired = errors.New("hancock: key has expired")
+	// ErrUsageNotAllowed is returned when signing with a hash or padding scheme the key doesn't
+	// allow.
+	ErrUsageNotAllowed = errors.New("hancock: key usage is not allowed")
+	// ErrSignatureLimit is returned when signing with a key which has signed its maximum number of
+	// signatures.
+	ErrSignatureLimit = errors.New("hancock: key has reached its signature limit")
+	// ErrInvalidState is returned when setting a key to an unknown state.
+	ErrInvalidState = errors.New("hancock: invalid key state")
+	// ErrInvalidStateTransition is returned when a key can't transition to a state, such as a
+	// compromised key being enabled.
+	ErrInvalidStateTransition = errors.New("hancock: invalid key state transition")
+	// ErrPendingDeletion is returned when signing with a key which is scheduled for deletion, or
+	// when scheduling it for deletion again.
+	ErrPendingDeletion = errors.New("hancock: key is pending deletion")
+	// ErrDestroyed is returned when fetching a key which has been destroyed.
+	ErrDestroyed = errors.New("hancock: key has been destroyed")
+	// ErrInvalidWaitingPeriod is returned when scheduling the deletion of a key with a waiting
+	// period that is out of bounds.
+	ErrInvalidWaitingPeriod = errors.New("hancock: invalid deletion waiting period")
+	// ErrInvalidOpts is returned when the options to generate a key or to sign with it are
+	// invalid.
+	ErrInvalidOpts = errors.New("hancock: invalid key options")
+	// ErrInvalidMetadata is returned when the labels or description of a key are invalid.
+	ErrInvalidMetadata = errors.New("hancock: invalid key metadata")
+	// ErrUnsupportedAlgorithm is returned when a key algorithm has no generator or codec.
+	ErrUnsupportedAlgorithm = errors.New("hancock: unsupported algorithm")
+	// ErrDecrypt is returned when a stored key can't be decrypted or decoded.
+	ErrDecrypt = errors.New("hancock: could not decrypt key")
+	// ErrSealed is returned when a secret is needed before the storage has been unsealed.
+	ErrSealed = errors.New("hancock: storage is sealed")
+	// ErrNotEnvelope is returned when rewrapping a key which isn't envelope encrypted yet. Such
+	// keys must be reencoded first.
+	ErrNotEnvelope = errors.New("hancock: key is not envelope encrypted")
+	// ErrKeyMismatch is returned when the configured secret doesn't match the secret which
+	// encrypted the stored keys.
+	ErrKeyMismatch = errors.New("hancock: master key does not match the key storage")
+)
@@ -2,10 +2,14 @@ package key
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
-	"errors"
 	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 )
 
 // GenerateSignerFunc is a type of function that produces a Signer given some `Opts`.
@@ -15,37 +19,98 @@ type GenerateSignerFunc func(o Opts) (crypto.Signer, error)
 // they rely.
 type SignerGenerator struct {
 	Generators map[string]GenerateSignerFunc
+	// Schemas specify the options of the algorithms. The `Opts` of algorithms with a schema are
+	// validated and coerced before they are passed to the generator.
+	Schemas map[string]OptsSchema
 }
 
 // New generates a new Signer using the cryptographic signing algorithm specified by alg using
-// the provided `Opts`.
+// the provided `Opts`. Invalid options wrap `ErrInvalidOpts`.
 func (f *SignerGenerator) New(alg string, o Opts) (crypto.Signer, error) {
 	g, ok := f.Generators[alg]
 	if !ok {
-		return nil, fmt.Errorf("algorithm '%s' is not a supported signer alg", alg)
+		return nil, fmt.Errorf("%w '%s' by the signer generator", ErrUnsupportedAlgorithm, alg)
+	}
+	if schema, ok := f.Schemas[alg]; ok {
+		var err error
+		if o, err = schema.Parse(o); err != nil {
+			return nil, err
+		}
 	}
 	return g(o)
 }
 
-// DefaultSignerGenerator is a sensible default generator that supports RSA.
+// DefaultSignerGenerator is a sensible default generator that supports RSA, ECDSA, Ed25519 and
+// secp256k1.
 var DefaultSignerGenerator = SignerGenerator{
 	Generators: map[string]GenerateSignerFunc{
-		RSA: rsaGenerateSigner,
+		RSA:       rsaGenerateSigner,
+		ECDSA:     ecdsaGenerateSigner,
+		ED25519:   ed25519GenerateSigner,
+		SECP256K1: secp256k1GenerateSigner,
+	},
+	Schemas: map[string]OptsSchema{
+		RSA: {
+			"bits": {Type: IntOpt, Default: MinRSABits, Min: MinRSABits, Max: MaxRSABits},
+		},
+		ECDSA: {
+			"curve": {Type: StringOpt, Default: "P-256", Values: []string{"P-256", "P-384", "P-521"}},
+		},
+		ED25519:   {},
+		SECP256K1: {},
 	},
 }
 
 // RSA
 
 func rsaGenerateSigner(o Opts) (crypto.Signer, error) {
-	var bits int
-	b, ok := o["bits"]
-	if !ok {
-		bits = 2048
-	} else {
-		if bits, ok = b.(int); !ok {
-			return nil, errors.New("Could not cast bits to int")
+	bits := MinRSABits
+	if b, ok := o["bits"]; ok {
+		if bits, ok = toInt(b); !ok {
+			return nil, fmt.Errorf("%w: option 'bits' must be an integer but got '%v'", ErrInvalidOpts, b)
 		}
 	}
 
 	return rsa.GenerateKey(rand.Reader, bits)
 }
+
+// ECDSA
+
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+func ecdsaGenerateSigner(o Opts) (crypto.Signer, error) {
+	name := "P-256"
+	c, ok := o["curve"]
+	if ok {
+		if name, ok = c.(string); !ok {
+			return nil, fmt.Errorf("%w: option 'curve' must be a string but got '%v'", ErrInvalidOpts, c)
+		}
+	}
+
+	curve, ok := curves[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: curve '%s' is not supported", ErrInvalidOpts, name)
+	}
+	return ecdsa.GenerateKey(curve, rand.Reader)
+}
+
+// Ed25519
+
+func ed25519GenerateSigner(o Opts) (crypto.Signer, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	return priv, err
+}
+
+// secp256k1
+
+func secp256k1GenerateSigner(o Opts) (crypto.Signer, error) {
+	k, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return &Secp256k1Signer{k}, nil
+}
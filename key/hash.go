@@ -0,0 +1,112 @@
+package key
+
+import (
+	"crypto"
+	_ "crypto/md5"    // register md5
+	_ "crypto/sha1"   // register sha1
+	_ "crypto/sha256" // register sha224 and sha256
+	_ "crypto/sha512" // register sha384, sha512 and its truncations
+	"fmt"
+	"io"
+
+	_ "golang.org/x/crypto/sha3" // register the sha3 family
+)
+
+// HashConfig provides configuration for a `HashRegistry`.
+type HashConfig struct {
+	// AllowLegacy enables hashes which are no longer considered secure, such as md5 and sha1.
+	AllowLegacy bool `json:"allow_legacy"`
+}
+
+// GetHashes returns a `HashRegistry` of the hashes in `DefaultHashRegistry` configured according
+// to the config.
+func (c HashConfig) GetHashes() *HashRegistry {
+	r := DefaultHashRegistry
+	r.AllowLegacy = c.AllowLegacy
+	return &r
+}
+
+// HashRegistry collects hashing algorithms by name.
+type HashRegistry struct {
+	// Hashes are always available.
+	Hashes map[string]crypto.Hash
+	// Legacy hashes are only available if AllowLegacy is set.
+	Legacy      map[string]crypto.Hash
+	AllowLegacy bool
+}
+
+// DefaultHashRegistry is a sensible default registry of the SHA-2 and SHA-3 families. It also
+// includes md5 and sha1 as legacy hashes, which are disallowed.
+var DefaultHashRegistry = HashRegistry{
+	Hashes: map[string]crypto.Hash{
+		"sha224":     crypto.SHA224,
+		"sha256":     crypto.SHA256,
+		"sha384":     crypto.SHA384,
+		"sha512":     crypto.SHA512,
+		"sha512_224": crypto.SHA512_224,
+		"sha512_256": crypto.SHA512_256,
+		"sha3_224":   crypto.SHA3_224,
+		"sha3_256":   crypto.SHA3_256,
+		"sha3_384":   crypto.SHA3_384,
+		"sha3_512":   crypto.SHA3_512,
+	},
+	Legacy: map[string]crypto.Hash{
+		"md5":  crypto.MD5,
+		"sha1": crypto.SHA1,
+	},
+}
+
+// Get returns the hashing algorithm registered as name.
+func (r *HashRegistry) Get(name string) (crypto.Hash, error) {
+	if h, ok := r.Hashes[name]; ok {
+		return h, nil
+	}
+	if h, ok := r.Legacy[name]; ok {
+		if !r.AllowLegacy {
+			return 0, fmt.Errorf("Hash '%s' is a legacy hash and is not allowed", name)
+		}
+		return h, nil
+	}
+	return 0, fmt.Errorf("Hash '%s' is not supported", name)
+}
+
+// Known reports whether name is registered, even as a legacy hash which isn't allowed.
+func (r *HashRegistry) Known(name string) bool {
+	_, ok := r.Hashes[name]
+	_, legacy := r.Legacy[name]
+	return ok || legacy
+}
+
+// Digest returns the hashing algorithm registered as name after checking that digest has the
+// size of its output.
+func (r *HashRegistry) Digest(name string, digest []byte) (crypto.Hash, error) {
+	h, err := r.Get(name)
+	if err != nil {
+		return 0, err
+	}
+	if !h.Available() {
+		return 0, fmt.Errorf("Hash '%s' is not available", name)
+	}
+	if len(digest) != h.Size() {
+		return 0, fmt.Errorf("Digest must be %d bytes for hash '%s' but got %d", h.Size(), name, len(digest))
+	}
+	return h, nil
+}
+
+// Sum streams msg through the hashing algorithm registered as name. It returns the algorithm and
+// the resulting digest.
+func (r *HashRegistry) Sum(name string, msg io.Reader) (crypto.Hash, []byte, error) {
+	h, err := r.Get(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !h.Available() {
+		return 0, nil, fmt.Errorf("Hash '%s' is not available", name)
+	}
+
+	hasher := h.New()
+	if _, err := io.Copy(hasher, msg); err != nil {
+		return 0, nil, err
+	}
+	return h, hasher.Sum(nil), nil
+}
@@ -0,0 +1,80 @@
+package key
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestHashRegistryDigest(t *testing.T) {
+	r := HashConfig{}.GetHashes()
+	for name, h := range r.Hashes {
+		digest := make([]byte, h.Size())
+		got, err := r.Digest(name, digest)
+		if err != nil {
+			t.Errorf("Digest(%s) error = %v", name, err)
+		} else if got != h {
+			t.Errorf("Digest(%s) = %v, want %v", name, got, h)
+		}
+
+		for _, n := range []int{0, h.Size() - 1, h.Size() + 1} {
+			if _, err := r.Digest(name, make([]byte, n)); err == nil {
+				t.Errorf("Digest(%s) accepted a %d byte digest", name, n)
+			}
+		}
+	}
+
+	if _, err := r.Digest("sha0", make([]byte, 20)); err == nil {
+		t.Error("Digest() accepted an unknown hash")
+	}
+}
+
+func TestHashRegistryLegacy(t *testing.T) {
+	r := HashConfig{}.GetHashes()
+	for name, h := range r.Legacy {
+		if !r.Known(name) {
+			t.Errorf("Known(%s) = false for a legacy hash", name)
+		}
+		if _, err := r.Get(name); err == nil {
+			t.Errorf("Get(%s) allowed a legacy hash", name)
+		}
+		if _, err := r.Digest(name, make([]byte, h.Size())); err == nil {
+			t.Errorf("Digest(%s) allowed a legacy hash", name)
+		}
+		if _, _, err := r.Sum(name, strings.NewReader("message")); err == nil {
+			t.Errorf("Sum(%s) allowed a legacy hash", name)
+		}
+	}
+
+	r = HashConfig{AllowLegacy: true}.GetHashes()
+	for name, h := range r.Legacy {
+		if _, err := r.Digest(name, make([]byte, h.Size())); err != nil {
+			t.Errorf("Digest(%s) error = %v with AllowLegacy", name, err)
+		}
+	}
+	if DefaultHashRegistry.AllowLegacy {
+		t.Error("GetHashes() changed DefaultHashRegistry")
+	}
+}
+
+func TestHashRegistrySum(t *testing.T) {
+	r := HashConfig{}.GetHashes()
+	msg := bytes.Repeat([]byte("message"), 10000)
+	// OneByteReader makes sure the message is streamed rather than read in a single call.
+	h, digest, err := r.Sum("sha256", iotest.OneByteReader(bytes.NewReader(msg)))
+	if err != nil {
+		t.Fatalf("Sum() error = %v", err)
+	}
+	want := sha256.Sum256(msg)
+	if h != crypto.SHA256 || !bytes.Equal(digest, want[:]) {
+		t.Errorf("Sum() = %v, %x, want %v, %x", h, digest, crypto.SHA256, want)
+	}
+
+	if _, _, err := r.Sum("sha256", iotest.ErrReader(io.ErrUnexpectedEOF)); err == nil {
+		t.Error("Sum() ignored a read error")
+	}
+}
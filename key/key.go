@@ -2,33 +2,62 @@
 package key
 
 import (
+	"context"
 	"crypto"
 	_ "encoding/json" // for json tagging of structs
 	"fmt"
+	"reflect"
 	"sync"
+	"time"
 )
 
 var (
 	driversMu sync.RWMutex
-	drivers   = make(map[string]Storage)
+	drivers   = make(map[string]Factory)
 )
 
-// Register makes a key `Storage` available by the provided name. If Register is called twice
-// with the same name or if driver is nil, it panics.
-func Register(name string, driver Storage) {
+// Factory returns a new, unopened key `Storage`. It is called once for every `Open`.
+type Factory func() Storage
+
+// RegisterFactory makes a key `Storage` available by the provided name. Every call to `Open`
+// with that name opens a new `Storage` returned by factory. If RegisterFactory is called twice
+// with the same name or if factory is nil, it panics.
+func RegisterFactory(name string, factory Factory) {
 	driversMu.Lock()
 	defer driversMu.Unlock()
-	if driver == nil {
+	if factory == nil {
 		panic("hancock: Register driver is nil")
 	}
 	if _, dup := drivers[name]; dup {
 		panic("hancock: Register called twice for driver " + name)
 	}
-	drivers[name] = driver
+	drivers[name] = factory
+}
+
+// Register makes a key `Storage` available by the provided name. If driver is a pointer, every
+// call to `Open` opens a new zero value of the type it points to. Otherwise, driver itself is
+// opened every time. If Register is called twice with the same name or if driver is nil, it
+// panics.
+//
+// Deprecated: Use `RegisterFactory`, which doesn't rely on the zero value being usable.
+func Register(name string, driver Storage) {
+	if driver == nil {
+		panic("hancock: Register driver is nil")
+	}
+
+	t := reflect.TypeOf(driver)
+	if t.Kind() != reflect.Ptr {
+		RegisterFactory(name, func() Storage { return driver })
+		return
+	}
+	RegisterFactory(name, func() Storage {
+		return reflect.New(t.Elem()).Interface().(Storage)
+	})
 }
 
 // Open opens a key `Storage` specified by its storage name and configuration. The configuration
-// is usually a []byte representation of a json config.
+// is usually a []byte representation of a json config. Each call returns a new `Storage`, so
+// opening a driver twice doesn't share connections or keys.
 //
 // Most users will open storage via a driver-specific connetion helper function that returns a Storage.
 // Hancock includes a few drivers which are subpackages of key.
@@ -36,12 +65,17 @@ func Register(name string, driver Storage) {
 // Open may just validate its arguments without creating a connection to the Storage.
 func Open(driverName string, config []byte) (Storage, error) {
 	driversMu.RLock()
-	driver, ok := drivers[driverName]
+	factory, ok := drivers[driverName]
 	driversMu.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("hancock: unknown driver %s (forgotten import?)", driverName)
 	}
-	return driver, driver.Open(config)
+
+	driver := factory()
+	if err := driver.Open(config); err != nil {
+		return nil, err
+	}
+	return driver, nil
 }
 
 // Key is an interface for opaque cryptographic signing keys.
@@ -50,24 +84,113 @@ type Key struct {
 	ID string `json:"id" sql:"id"`
 	// Algorithm specifies the cryptographic signing algorithm underlying this key.
 	Algorithm string `json:"alg" sql:"alg"`
+	Metadata
+	// CreatedAt is the time the key was created.
+	CreatedAt time.Time `json:"created_at" sql:"created_at"`
+	// UpdatedAt is the time the key was last changed, such as its `Metadata`.
+	UpdatedAt time.Time `json:"updated_at" sql:"updated_at"`
+	// State is either `Enabled`, `Disabled` or `Compromised`. Only enabled keys can sign.
+	State string `json:"state" sql:"state"`
+	// CompromisedAt is the time the key was marked compromised.
+	CompromisedAt *time.Time `json:"compromised_at,omitempty" sql:"compromised_at"`
+	// NextRotationTime is the time the key will be rotated automatically, if it has a rotation
+	// period.
+	NextRotationTime *time.Time `json:"next_rotation_time,omitempty" sql:"next_rotation_time"`
+	// DeletionTime is the time the key will be destroyed, if it is scheduled for deletion.
+	DeletionTime *time.Time `json:"deletion_time,omitempty" sql:"deletion_time"`
+	// SignatureCount is the number of signatures counted by `Storage.CountSignature`. Only keys
+	// with a `MaxSignatures` are counted.
+	SignatureCount int64 `json:"signature_count" sql:"signature_count"`
+	// Version is the primary version of the key, which signs with Signer.
+	Version int `json:"version" sql:"primary_version"`
+	// Versions are every version of the key that hasn't been destroyed, in order. They are only
+	// set on fetched keys.
+	Versions []Version `json:"-"`
 	// Signer implements the crypto.Signer interface which can be used for signing and inspecting
-	// the public key.
-	Signer crypto.Signer
+	// the public key. It signs with the primary version of the key.
+	Signer crypto.Signer `json:"-"`
+}
+
+// Pure reports whether the key signs full messages rather than digests. Signers of pure keys,
+// such as Ed25519, must be called with the message and crypto.Hash(0) as the `crypto.SignerOpts`.
+func (k *Key) Pure() bool {
+	return k.Algorithm == ED25519
 }
 
-// Opts specify additional options used in `Key` generation.
+// Opts specify additional options used in `Key` generation. The options of each algorithm are
+// specified by an `OptsSchema`.
 type Opts map[string]interface{}
 
 // Storage is an interface for a storage backend of `Key`s. Some implementations of Storage can
 // be found as subpackages of key.
 type Storage interface {
-	// Get retrieves a `*Key` using the unique identifier id. If no key with that id is found, both
-	// return values are null.
+	// Get retrieves a `*Key` using the unique identifier id. If no key with that id is found, the
+	// error wraps `ErrNotFound`. If id can't identify a key at all, the error wraps `ErrInvalidID`.
 	Get(id string) (*Key, error)
+	// GetContext is like Get, but stops waiting on the storage device once ctx is done.
+	GetContext(ctx context.Context, id string) (*Key, error)
 	// Create inserts a new `Key` generated using the algorithm specified by alg and the provided
 	// `Opts`. The resulting `Key` is returned.
 	Create(alg string, o Opts) (*Key, error)
+	// CreateContext is like Create, but the key is described by m and it stops waiting on the
+	// storage device once ctx is done. Invalid metadata wraps `ErrInvalidMetadata`.
+	CreateContext(ctx context.Context, alg string, o Opts, m Metadata) (*Key, error)
+	// UpdateMetadata changes the `Metadata` of a key as specified by u. Invalid metadata wraps
+	// `ErrInvalidMetadata`. The returned `Key` doesn't have a `Signer`.
+	UpdateMetadata(ctx context.Context, id string, u MetadataUpdate) (*Key, error)
+	// List returns a page of the keys matching the `ListOptions`, in order of creation. Listed
+	// keys don't have a `Signer` and destroyed keys aren't listed. A malformed cursor or limit
+	// wraps `ErrInvalidListOptions`.
+	List(ctx context.Context, o ListOptions) (*KeyList, error)
+	// SetState transitions a key to state, as by `Key.SetState`. Public keys can be fetched in
+	// any state. The returned `Key` doesn't have a `Signer`.
+	SetState(ctx context.Context, id string, state string) (*Key, error)
+	// Rotate creates a new version of a key like its primary version and makes it the primary
+	// version. Keys which can't sign can't be rotated. The returned `Key` doesn't have a `Signer`.
+	Rotate(ctx context.Context, id string) (*Key, error)
+	// RotateDue rotates every key whose next rotation time has passed, as by Rotate. It returns
+	// the number of keys rotated. A key is never rotated twice for the same rotation time, even
+	// if RotateDue runs concurrently. A key which fails to rotate doesn't stop the others, and
+	// the errors of all such keys are returned as `RotationErrors`.
+	RotateDue(ctx context.Context) (int, error)
+	// CountSignature counts a signature by the key before it signs. Counting is atomic, so that
+	// keys never sign more than their `MaxSignatures`. Once they have, the error wraps
+	// `ErrSignatureLimit`. Keys without a maximum aren't counted.
+	CountSignature(ctx context.Context, id string) error
+	// RefundSignature takes back a signature counted by CountSignature, if signing failed after
+	// it was counted.
+	RefundSignature(ctx context.Context, id string) error
+	// ScheduleDeletion schedules the key to be destroyed once waitingPeriod has passed. Until
+	// then, the key can't sign, but it can be restored with CancelDeletion. A zero waitingPeriod
+	// uses `DefaultDeletionWaitingPeriod`. The returned `Key` doesn't have a `Signer`.
+	ScheduleDeletion(ctx context.Context, id string, waitingPeriod time.Duration) (*Key, error)
+	// CancelDeletion restores a key scheduled for deletion. It does nothing if the key isn't
+	// scheduled for deletion. The returned `Key` doesn't have a `Signer`.
+	CancelDeletion(ctx context.Context, id string) (*Key, error)
+	// Purge destroys every key whose deletion time has passed by overwriting its private key. It
+	// returns the number of keys destroyed. Fetching a destroyed key wraps `ErrDestroyed`.
+	Purge(ctx context.Context) (int, error)
 	// Open opens a key storage. This must be called before calling other methods on `Storage`.
 	// Most users will Open a key `Storage` using the a driverName as in `Open`.
 	Open(config []byte) error
+	// Close releases the resources held by the storage, such as database connections. The
+	// `Storage` must not be used after it is closed.
+	Close() error
+}
+
+// Reencoder is implemented by `Storage`s that serialize keys with a `MultiCodec`. It is used to
+// migrate stored keys to the current encoding, such as from a legacy encoding to PKCS #8.
+type Reencoder interface {
+	// Reencode decodes every stored key and encodes it again with the current `MultiCodec`. It
+	// returns the number of keys that were reencoded.
+	Reencode() (int, error)
+}
+
+// Rewrapper is implemented by `Storage`s using envelope encryption. It is used to rotate the
+// key-encryption key.
+type Rewrapper interface {
+	// Rewrap rewraps the data key of every stored key with the primary key-encryption key. It
+	// returns the number of keys that were rewrapped. Keys which aren't envelope encrypted are
+	// skipped, in which case the error wraps `ErrNotEnvelope`.
+	Rewrap() (int, error)
 }
@@ -0,0 +1,104 @@
+package key
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultListLimit is the number of keys listed when `ListOptions.Limit` is not set.
+	DefaultListLimit = 100
+	// MaxListLimit is the maximum number of keys listed at once.
+	MaxListLimit = 1000
+)
+
+// ListOptions filter and paginate the keys returned by `Storage.List`. Keys are listed in order
+// of creation.
+type ListOptions struct {
+	// Algorithm only lists keys of the algorithm, if it is not empty.
+	Algorithm string
+	// CreatedSince only lists keys created at or after the time, if it is not zero.
+	CreatedSince time.Time
+	// CreatedBefore only lists keys created before the time, if it is not zero.
+	CreatedBefore time.Time
+	// Labels only lists keys which have every label.
+	Labels map[string]string
+	// ExpiresBefore only lists keys with a not after time before the time, if it is not zero.
+	// It finds keys which expire soon.
+	ExpiresBefore time.Time
+	// Cursor continues listing after the last key of a previous `KeyList`.
+	Cursor string
+	// Limit is the maximum number of keys listed. It defaults to `DefaultListLimit` and must not
+	// exceed `MaxListLimit`.
+	Limit int
+}
+
+// GetLimit returns the number of keys to list, or an error if the limit is out of bounds.
+func (o *ListOptions) GetLimit() (int, error) {
+	if o.Limit == 0 {
+		return DefaultListLimit, nil
+	}
+	if o.Limit < 0 || o.Limit > MaxListLimit {
+		return 0, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidListOptions, MaxListLimit)
+	}
+	return o.Limit, nil
+}
+
+// Match reports whether k passes the algorithm, creation time, label and expiry filters.
+func (o *ListOptions) Match(k *Key) bool {
+	if o.Algorithm != "" && k.Algorithm != o.Algorithm {
+		return false
+	}
+	if !o.CreatedSince.IsZero() && k.CreatedAt.Before(o.CreatedSince) {
+		return false
+	}
+	if !o.CreatedBefore.IsZero() && !k.CreatedAt.Before(o.CreatedBefore) {
+		return false
+	}
+	if !o.ExpiresBefore.IsZero() && (k.NotAfter == nil || !k.NotAfter.Before(o.ExpiresBefore)) {
+		return false
+	}
+	return k.HasLabels(o.Labels)
+}
+
+// KeyList is a page of keys returned by `Storage.List`. The keys don't have a `Signer`, so their
+// private keys are never decrypted by listing.
+type KeyList struct {
+	Keys []*Key `json:"keys"`
+	// NextCursor continues listing after the last key in Keys. It is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// EncodeCursor returns an opaque cursor pointing at the key with id, created at createdAt.
+func EncodeCursor(createdAt time.Time, id string) string {
+	c := createdAt.UTC().Format(time.RFC3339Nano) + " " + id
+	return base64.RawURLEncoding.EncodeToString([]byte(c))
+}
+
+// DecodeCursor returns the creation time and id of the key a cursor points at.
+func DecodeCursor(cursor string) (time.Time, string, error) {
+	c, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+
+	parts := strings.SplitN(string(c), " ", 2)
+	if len(parts) != 2 {
+		return time.Time{}, "", fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+	return createdAt, parts[1], nil
+}
+
+// After reports whether k is listed after the key at createdAt with id.
+func (k *Key) After(createdAt time.Time, id string) bool {
+	if !k.CreatedAt.Equal(createdAt) {
+		return k.CreatedAt.After(createdAt)
+	}
+	return k.ID > id
+}
@@ -2,7 +2,11 @@
 package mem
 
 import (
+	"context"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -14,8 +18,9 @@ const (
 )
 
 func init() {
-	s := &KeyStorage{}
-	key.Register(driverName, s)
+	key.RegisterFactory(driverName, func() key.Storage {
+		return &KeyStorage{}
+	})
 }
 
 // KeyStorage implements the key.Storage interface using memory as the storage device. Retrival
@@ -23,44 +28,333 @@ func init() {
 type KeyStorage struct {
 	sync.RWMutex
 	m         map[string]key.Key
+	destroyed map[string]bool
 	generator key.SignerGenerator
 }
 
-// Get retrieves a key identified by id from memory.
+// Get retrieves a key identified by id from memory. All IDs MUST parse to a valid uuid.
 func (s *KeyStorage) Get(id string) (*key.Key, error) {
+	return s.GetContext(context.Background(), id)
+}
+
+// GetContext retrieves a key identified by id from memory, unless ctx is already done.
+func (s *KeyStorage) GetContext(ctx context.Context, id string) (*key.Key, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("%w '%s': %v", key.ErrInvalidID, id, err)
+	}
+
 	s.RLock()
 	defer s.RUnlock()
 
+	return s.get(id)
+}
+
+// get returns the key identified by id. The caller must hold the lock.
+func (s *KeyStorage) get(id string) (*key.Key, error) {
 	k, ok := s.m[id]
 	if !ok {
-		return nil, nil
+		if s.destroyed[id] {
+			return nil, fmt.Errorf("%w: '%s'", key.ErrDestroyed, id)
+		}
+		return nil, fmt.Errorf("%w: '%s'", key.ErrNotFound, id)
 	}
 	return &k, nil
 }
 
 // Create inserts a new key of type alg in memory.
 func (s *KeyStorage) Create(alg string, opts key.Opts) (*key.Key, error) {
-	s.Lock()
-	defer s.Unlock()
+	return s.CreateContext(context.Background(), alg, opts, key.Metadata{})
+}
+
+// CreateContext inserts a new key of type alg described by m in memory, unless ctx is done
+// before the key has been generated.
+func (s *KeyStorage) CreateContext(ctx context.Context, alg string, opts key.Opts, m key.Metadata) (*key.Key, error) {
+	if err := m.ValidateFor(alg); err != nil {
+		return nil, err
+	}
+	m.Labels = copyLabels(m.Labels)
+	m.AllowedHashes = append([]string(nil), m.AllowedHashes...)
+	m.AllowedPaddings = append([]string(nil), m.AllowedPaddings...)
 
 	signer, err := s.generator.New(alg, opts)
 	if err != nil {
 		return nil, err
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
 
+	now := time.Now().UTC()
 	k := key.Key{
 		ID:        uuid.New().String(),
 		Algorithm: alg,
+		Metadata:  m,
+		State:     key.Enabled,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Version:   1,
+		Versions:  []key.Version{{Version: 1, CreatedAt: now, Signer: signer}},
 		Signer:    signer,
 	}
+	k.ScheduleRotation(now)
 
 	s.m[k.ID] = k
 	return &k, nil
 }
 
+// List returns a page of the keys in memory matching o, in order of creation.
+func (s *KeyStorage) List(ctx context.Context, o key.ListOptions) (*key.KeyList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit, err := o.GetLimit()
+	if err != nil {
+		return nil, err
+	}
+
+	var cursorTime time.Time
+	var cursorID string
+	if o.Cursor != "" {
+		if cursorTime, cursorID, err = key.DecodeCursor(o.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	s.RLock()
+	keys := make([]*key.Key, 0, len(s.m))
+	for _, k := range s.m {
+		k := k
+		k.Signer = nil
+		k.Versions = nil
+		if o.Match(&k) && (o.Cursor == "" || k.After(cursorTime, cursorID)) {
+			keys = append(keys, &k)
+		}
+	}
+	s.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[j].After(keys[i].CreatedAt, keys[i].ID)
+	})
+
+	l := &key.KeyList{Keys: keys}
+	if len(keys) > limit {
+		l.Keys = keys[:limit]
+		last := l.Keys[limit-1]
+		l.NextCursor = key.EncodeCursor(last.CreatedAt, last.ID)
+	}
+	return l, nil
+}
+
+// SetState transitions the key identified by id to state.
+func (s *KeyStorage) SetState(ctx context.Context, id string, state string) (*key.Key, error) {
+	return s.update(ctx, id, func(k *key.Key) error {
+		return k.SetState(state)
+	})
+}
+
+// Rotate creates a new primary version of the key identified by id.
+func (s *KeyStorage) Rotate(ctx context.Context, id string) (*key.Key, error) {
+	return s.update(ctx, id, s.rotate)
+}
+
+// RotateDue rotates every key in memory whose next rotation time has passed.
+func (s *KeyStorage) RotateDue(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	n := 0
+	errs := make(key.RotationErrors)
+	for id, k := range s.m {
+		if !k.RotationDue(now) {
+			continue
+		}
+		if err := s.rotate(&k); err != nil {
+			errs[id] = err
+			continue
+		}
+		k.UpdatedAt = time.Now().UTC()
+		s.m[id] = k
+		n++
+	}
+	if len(errs) > 0 {
+		return n, errs
+	}
+	return n, nil
+}
+
+// rotate adds a new primary version to k, like its current primary version.
+func (s *KeyStorage) rotate(k *key.Key) error {
+	if err := k.CheckSign(); err != nil {
+		return err
+	}
+
+	signer, err := s.generator.New(k.Algorithm, key.RotationOpts(k.Signer))
+	if err != nil {
+		return err
+	}
+
+	v := key.Version{
+		Version:   k.Versions[len(k.Versions)-1].Version + 1,
+		CreatedAt: time.Now().UTC(),
+		Signer:    signer,
+	}
+	k.Versions = append(append([]key.Version{}, k.Versions...), v)
+	k.Version = v.Version
+	k.Signer = signer
+	k.ScheduleRotation(v.CreatedAt)
+	return nil
+}
+
+// CountSignature counts a signature by the key identified by id, unless it has signed its
+// maximum number of signatures. The key isn't otherwise changed, so its update time is kept.
+func (s *KeyStorage) CountSignature(ctx context.Context, id string) error {
+	return s.updateSignatureCount(ctx, id, (*key.Key).CountSignature)
+}
+
+// RefundSignature takes back a signature counted by CountSignature which wasn't made.
+func (s *KeyStorage) RefundSignature(ctx context.Context, id string) error {
+	return s.updateSignatureCount(ctx, id, func(k *key.Key) error {
+		k.RefundSignature()
+		return nil
+	})
+}
+
+// updateSignatureCount applies f to the key identified by id, without changing its update time.
+func (s *KeyStorage) updateSignatureCount(ctx context.Context, id string, f func(k *key.Key) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("%w '%s': %v", key.ErrInvalidID, id, err)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	k, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if err := f(k); err != nil {
+		return err
+	}
+	s.m[id] = *k
+	return nil
+}
+
+// ScheduleDeletion schedules the key identified by id to be destroyed once waitingPeriod has
+// passed.
+func (s *KeyStorage) ScheduleDeletion(ctx context.Context, id string, waitingPeriod time.Duration) (*key.Key, error) {
+	return s.update(ctx, id, func(k *key.Key) error {
+		return k.ScheduleDeletion(waitingPeriod)
+	})
+}
+
+// CancelDeletion restores the key identified by id if it is scheduled for deletion.
+func (s *KeyStorage) CancelDeletion(ctx context.Context, id string) (*key.Key, error) {
+	return s.update(ctx, id, func(k *key.Key) error {
+		k.DeletionTime = nil
+		return nil
+	})
+}
+
+// UpdateMetadata changes the metadata of the key identified by id as specified by u.
+func (s *KeyStorage) UpdateMetadata(ctx context.Context, id string, u key.MetadataUpdate) (*key.Key, error) {
+	return s.update(ctx, id, func(k *key.Key) error {
+		if err := k.UpdateMetadata(u, time.Now().UTC()); err != nil {
+			return err
+		}
+		k.Labels = copyLabels(k.Labels)
+		return nil
+	})
+}
+
+// Purge destroys every key whose deletion time has passed by removing it from memory.
+func (s *KeyStorage) Purge(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	n := 0
+	for id, k := range s.m {
+		if k.PendingDeletion() && !k.DeletionTime.After(now) {
+			delete(s.m, id)
+			s.destroyed[id] = true
+			n++
+		}
+	}
+	return n, nil
+}
+
+// update applies f to the key identified by id and returns the updated key without its signer.
+func (s *KeyStorage) update(ctx context.Context, id string, f func(k *key.Key) error) (*key.Key, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("%w '%s': %v", key.ErrInvalidID, id, err)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	k, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := f(k); err != nil {
+		return nil, err
+	}
+	k.UpdatedAt = time.Now().UTC()
+	s.m[id] = *k
+
+	k.Signer = nil
+	k.Versions = nil
+	return k, nil
+}
+
+// copyLabels copies labels, so that keys in memory don't share them with callers.
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	c := make(map[string]string, len(labels))
+	for name, value := range labels {
+		c[name] = value
+	}
+	return c
+}
+
 // Open initializes a new in-memory `KeyStorage`. The config is not used and can be left empty.
 func (s *KeyStorage) Open(config []byte) error {
 	s.m = make(map[string]key.Key)
+	s.destroyed = make(map[string]bool)
 	s.generator = key.DefaultSignerGenerator
 	return nil
 }
+
+// Close discards every key in memory.
+func (s *KeyStorage) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.m = nil
+	s.destroyed = nil
+	return nil
+}
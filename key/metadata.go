@@ -0,0 +1,167 @@
+package key
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxLabels is the maximum number of labels on a key.
+	MaxLabels = 64
+	// MaxLabelValueLength is the maximum length of a label value.
+	MaxLabelValueLength = 255
+	// MaxDescriptionLength is the maximum length of a key description.
+	MaxDescriptionLength = 1024
+)
+
+// labelNamePattern matches valid label names.
+var labelNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9_.-]{0,61}[a-z0-9])?$`)
+
+// Metadata describes a `Key`, how it is rotated and how it may sign. Only the validity period
+// and usage constraints have an effect on signing.
+type Metadata struct {
+	// Labels are user-defined name and value pairs that can be used to filter listed keys.
+	Labels map[string]string `json:"labels,omitempty" sql:"labels"`
+	// Description is a user-defined description of the key.
+	Description string `json:"description,omitempty" sql:"description"`
+	// Creator identifies who created the key. It can't be updated.
+	Creator string `json:"creator,omitempty" sql:"creator"`
+	// RotationPeriod is the period after which the key is rotated automatically. Zero disables
+	// automatic rotation.
+	RotationPeriod Duration `json:"rotation_period,omitempty" sql:"rotation_period"`
+	// NotBefore is the time from which the key may sign, if it is set. It can't be updated.
+	NotBefore *time.Time `json:"not_before,omitempty" sql:"not_before"`
+	// NotAfter is the time after which the key may no longer sign, if it is set. It can't be
+	// updated.
+	NotAfter *time.Time `json:"not_after,omitempty" sql:"not_after"`
+	// AllowedHashes are the names of the hashes the key may sign digests of. Any hash is allowed
+	// if it is empty. It can't be updated.
+	AllowedHashes []string `json:"allowed_hashes,omitempty" sql:"allowed_hashes"`
+	// AllowedPaddings are the padding schemes RSA keys may sign with. Any padding scheme is allowed
+	// if it is empty. It can't be updated.
+	AllowedPaddings []string `json:"allowed_paddings,omitempty" sql:"allowed_paddings"`
+	// MaxSignatures is the number of signatures after which the key can no longer sign, such as 1
+	// for one-time-use keys. Zero allows any number of signatures. It can't be updated.
+	MaxSignatures int64 `json:"max_signatures,omitempty" sql:"max_signatures"`
+}
+
+// Validate returns an error wrapping `ErrInvalidMetadata` if the labels, description, rotation
+// period, validity period or usage constraints are invalid. Label names must be lowercase
+// alphanumeric, dashes, underscores or dots, and at most 63 characters long.
+func (m *Metadata) Validate() error {
+	if len(m.Labels) > MaxLabels {
+		return fmt.Errorf("%w: a key can't have more than %d labels", ErrInvalidMetadata, MaxLabels)
+	}
+	for name, value := range m.Labels {
+		if !labelNamePattern.MatchString(name) {
+			return fmt.Errorf("%w: label name '%s' is not valid", ErrInvalidMetadata, name)
+		}
+		if len(value) > MaxLabelValueLength {
+			return fmt.Errorf("%w: value of label '%s' is longer than %d characters", ErrInvalidMetadata,
+				name, MaxLabelValueLength)
+		}
+	}
+	if len(m.Description) > MaxDescriptionLength {
+		return fmt.Errorf("%w: description is longer than %d characters", ErrInvalidMetadata,
+			MaxDescriptionLength)
+	}
+	if m.RotationPeriod != 0 && time.Duration(m.RotationPeriod) < MinRotationPeriod {
+		return fmt.Errorf("%w: rotation period must be at least %s", ErrInvalidMetadata,
+			MinRotationPeriod)
+	}
+	if m.NotBefore != nil && m.NotAfter != nil && !m.NotAfter.After(*m.NotBefore) {
+		return fmt.Errorf("%w: not after must be later than not before", ErrInvalidMetadata)
+	}
+	for _, hash := range m.AllowedHashes {
+		if !DefaultHashRegistry.Known(hash) {
+			return fmt.Errorf("%w: hash '%s' is not supported", ErrInvalidMetadata, hash)
+		}
+	}
+	for _, padding := range m.AllowedPaddings {
+		if padding != PKCS1v15 && padding != PSS {
+			return fmt.Errorf("%w: padding '%s' is not supported", ErrInvalidMetadata, padding)
+		}
+	}
+	if m.MaxSignatures < 0 {
+		return fmt.Errorf("%w: max signatures must not be negative", ErrInvalidMetadata)
+	}
+	return nil
+}
+
+// ValidateFor is like Validate, but also returns an error wrapping `ErrInvalidMetadata` if the
+// usage constraints don't apply to keys of the algorithm alg, such as padding schemes of keys
+// other than RSA.
+func (m *Metadata) ValidateFor(alg string) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	if len(m.AllowedPaddings) > 0 && alg != RSA {
+		return fmt.Errorf("%w: '%s' keys don't support allowed paddings", ErrInvalidMetadata, alg)
+	}
+	if k := (Key{Algorithm: alg}); len(m.AllowedHashes) > 0 && k.Pure() {
+		return fmt.Errorf("%w: '%s' keys sign messages and don't support allowed hashes",
+			ErrInvalidMetadata, alg)
+	}
+	return nil
+}
+
+// MetadataUpdate changes the `Metadata` of a key. Nil fields are left unchanged.
+type MetadataUpdate struct {
+	// Labels replace every label of the key. An empty map removes all labels.
+	Labels map[string]string `json:"labels"`
+	// Description replaces the description of the key.
+	Description *string `json:"description"`
+	// RotationPeriod replaces the rotation period of the key.
+	RotationPeriod *Duration `json:"rotation_period"`
+}
+
+// Apply returns m changed by u, or an error wrapping `ErrInvalidMetadata` if the result is
+// invalid.
+func (u *MetadataUpdate) Apply(m Metadata) (Metadata, error) {
+	if u.Labels != nil {
+		m.Labels = u.Labels
+	}
+	if u.Description != nil {
+		m.Description = *u.Description
+	}
+	if u.RotationPeriod != nil {
+		m.RotationPeriod = *u.RotationPeriod
+	}
+	return m, m.Validate()
+}
+
+// HasLabels reports whether the key has every label in labels.
+func (m *Metadata) HasLabels(labels map[string]string) bool {
+	for name, value := range labels {
+		if v, ok := m.Labels[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatLabels formats labels as comma separated name=value pairs, sorted by name.
+func FormatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// ParseLabels parses name=value pairs into labels.
+func ParseLabels(pairs []string) (map[string]string, error) {
+	labels := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%w: label '%s' is not a name=value pair", ErrInvalidMetadata, pair)
+		}
+		labels[parts[0]] = parts[1]
+	}
+	return labels, nil
+}
@@ -0,0 +1,141 @@
+package key
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MinRSABits is the smallest size of generated RSA keys.
+	MinRSABits = 2048
+	// MaxRSABits is the largest size of generated RSA keys.
+	MaxRSABits = 8192
+)
+
+// OptType is the type of a key generation option.
+type OptType int
+
+const (
+	// IntOpt options are integers. Whole numbers of other types, such as the float64 numbers
+	// decoded from JSON, and decimal strings are coerced to int.
+	IntOpt OptType = iota
+	// StringOpt options are strings.
+	StringOpt
+)
+
+// OptSpec specifies a key generation option.
+type OptSpec struct {
+	Type OptType
+	// Default is the value of the option if it isn't set.
+	Default interface{}
+	// Min and Max bound the value of integer options, unless they are zero.
+	Min, Max int
+	// Values are the allowed values of string options. Any string is allowed if it is empty.
+	Values []string
+}
+
+// OptsSchema specifies every option of an algorithm by name.
+type OptsSchema map[string]OptSpec
+
+// Parse validates o against the schema and returns a copy of it in which every option has the
+// type of its `OptSpec`, and unset options have their default. The error wraps `ErrInvalidOpts`
+// if an option is unknown, can't be coerced to its type or is out of bounds.
+func (s OptsSchema) Parse(o Opts) (Opts, error) {
+	names := make([]string, 0, len(o))
+	for name := range o {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parsed := make(Opts, len(s))
+	for _, name := range names {
+		spec, ok := s[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: option '%s' is not supported", ErrInvalidOpts, name)
+		}
+		v, err := spec.parse(name, o[name])
+		if err != nil {
+			return nil, err
+		}
+		parsed[name] = v
+	}
+	for name, spec := range s {
+		if _, ok := parsed[name]; !ok && spec.Default != nil {
+			parsed[name] = spec.Default
+		}
+	}
+	return parsed, nil
+}
+
+func (spec OptSpec) parse(name string, v interface{}) (interface{}, error) {
+	switch spec.Type {
+	case IntOpt:
+		i, ok := toInt(v)
+		if !ok {
+			return nil, fmt.Errorf("%w: option '%s' must be an integer but got '%v'", ErrInvalidOpts, name, v)
+		}
+		if spec.Min != 0 && i < spec.Min {
+			return nil, fmt.Errorf("%w: option '%s' must be at least %d but got %d", ErrInvalidOpts, name,
+				spec.Min, i)
+		}
+		if spec.Max != 0 && i > spec.Max {
+			return nil, fmt.Errorf("%w: option '%s' must be at most %d but got %d", ErrInvalidOpts, name,
+				spec.Max, i)
+		}
+		return i, nil
+	case StringOpt:
+		str, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: option '%s' must be a string but got '%v'", ErrInvalidOpts, name, v)
+		}
+		if len(spec.Values) > 0 && !contains(spec.Values, str) {
+			return nil, fmt.Errorf("%w: option '%s' must be one of %s but got '%s'", ErrInvalidOpts, name,
+				strings.Join(spec.Values, ", "), str)
+		}
+		return str, nil
+	default:
+		return nil, fmt.Errorf("%w: option '%s' has an unknown type", ErrInvalidOpts, name)
+	}
+}
+
+// toInt coerces whole numbers and decimal strings to int.
+func toInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case float64:
+		if n != math.Trunc(n) || math.Abs(n) > math.MaxInt32 {
+			return 0, false
+		}
+		return int(n), true
+	case json.Number:
+		i, err := strconv.Atoi(n.String())
+		return i, err == nil
+	case string:
+		i, err := strconv.Atoi(n)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// ParseOpts parses name=value pairs, such as those given on the command line, into `Opts`. The
+// values are strings, which are coerced to the option's type when the key is generated.
+func ParseOpts(pairs []string) (Opts, error) {
+	o := make(Opts, len(pairs))
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%w: option '%s' is not a name=value pair", ErrInvalidOpts, pair)
+		}
+		o[parts[0]] = parts[1]
+	}
+	return o, nil
+}
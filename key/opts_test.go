@@ -0,0 +1,103 @@
+package key
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestOptsSchemaParseRSA(t *testing.T) {
+	schema := DefaultSignerGenerator.Schemas[RSA]
+	tests := []struct {
+		name     string
+		opts     Opts
+		wantBits int
+		wantErr  bool
+	}{
+		{"default", nil, MinRSABits, false},
+		{"minimum", Opts{"bits": MinRSABits}, MinRSABits, false},
+		{"maximum", Opts{"bits": MaxRSABits}, MaxRSABits, false},
+		{"below minimum", Opts{"bits": MinRSABits - 1}, 0, true},
+		{"above maximum", Opts{"bits": MaxRSABits + 1}, 0, true},
+		{"json number", Opts{"bits": float64(4096)}, 4096, false},
+		{"json.Number", Opts{"bits": json.Number("4096")}, 4096, false},
+		{"string", Opts{"bits": "4096"}, 4096, false},
+		{"fraction", Opts{"bits": 2048.5}, 0, true},
+		{"fraction string", Opts{"bits": "2048.5"}, 0, true},
+		{"not a number", Opts{"bits": "many"}, 0, true},
+		{"boolean", Opts{"bits": true}, 0, true},
+		{"unknown option", Opts{"bits": 4096, "exponent": 3}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := schema.Parse(tt.opts)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidOpts) {
+					t.Fatalf("Parse(%v) error = %v, want ErrInvalidOpts", tt.opts, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%v) error = %v", tt.opts, err)
+			}
+			if got["bits"] != tt.wantBits {
+				t.Errorf("Parse(%v) bits = %v, want %d", tt.opts, got["bits"], tt.wantBits)
+			}
+		})
+	}
+}
+
+func TestOptsSchemaParseNoOpts(t *testing.T) {
+	for _, alg := range []string{ED25519, SECP256K1} {
+		schema := DefaultSignerGenerator.Schemas[alg]
+		if got, err := schema.Parse(nil); err != nil || len(got) != 0 {
+			t.Errorf("Parse() of '%s' = %v, %v", alg, got, err)
+		}
+		for _, o := range []Opts{{"bits": 2048}, {"curve": "P-256"}, {"seed": "00"}} {
+			if _, err := schema.Parse(o); !errors.Is(err, ErrInvalidOpts) {
+				t.Errorf("Parse(%v) of '%s' error = %v, want ErrInvalidOpts", o, alg, err)
+			}
+		}
+	}
+}
+
+func TestOptsSchemaParseECDSA(t *testing.T) {
+	schema := DefaultSignerGenerator.Schemas[ECDSA]
+	got, err := schema.Parse(Opts{"curve": "P-384"})
+	if err != nil || got["curve"] != "P-384" {
+		t.Errorf("Parse() = %v, %v", got, err)
+	}
+	for _, o := range []Opts{{"curve": "P-224"}, {"curve": 256}} {
+		if _, err := schema.Parse(o); !errors.Is(err, ErrInvalidOpts) {
+			t.Errorf("Parse(%v) error = %v, want ErrInvalidOpts", o, err)
+		}
+	}
+}
+
+func TestToInt(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want int
+		ok   bool
+	}{
+		{2048, 2048, true},
+		{int32(2048), 2048, true},
+		{int64(2048), 2048, true},
+		{float64(2048), 2048, true},
+		{2048.5, 0, false},
+		{float64(1 << 40), 0, false},
+		{json.Number("2048"), 2048, true},
+		{json.Number("2048.0"), 0, false},
+		{"2048", 2048, true},
+		{"-1", -1, true},
+		{"", 0, false},
+		{" 2048", 0, false},
+		{nil, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := toInt(tt.v)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("toInt(%#v) = %d, %v, want %d, %v", tt.v, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package key
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+var (
+	// pkcs8Marker prefixes PKCS #8 encodings to distinguish them from legacy encodings.
+	pkcs8Marker = []byte{0xff, 'h', 'k', '8'}
+
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSecp256k1      = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+// Pkcs8MultiCodec implements the `MultiCodec` interface for every supported algorithm using
+// `Pkcs8Codec`. Encodings are prefixed with a format marker. Data without the marker is decoded
+// by Legacy, so keys serialized before PKCS #8 was introduced remain readable.
+type Pkcs8MultiCodec struct {
+	Legacy MultiCodec
+}
+
+// Encode serializes s to a marked PKCS #8 encoding.
+func (c *Pkcs8MultiCodec) Encode(s crypto.Signer, alg string) ([]byte, error) {
+	if a := Algorithm(s); a != alg {
+		return []byte{}, fmt.Errorf("algorithm '%s' does not match signer of type %T", alg, s)
+	}
+
+	der, err := (&Pkcs8Codec{}).Encode(s)
+	if err != nil {
+		return []byte{}, err
+	}
+	return append(append([]byte{}, pkcs8Marker...), der...), nil
+}
+
+// Decode deserializes marked PKCS #8 encodings or, failing that, legacy encodings.
+func (c *Pkcs8MultiCodec) Decode(priv []byte, alg string) (crypto.Signer, error) {
+	if bytes.HasPrefix(priv, pkcs8Marker) {
+		// A legacy encoding may begin with the marker by chance, in which case it won't parse.
+		s, err := (&Pkcs8Codec{}).Decode(priv[len(pkcs8Marker):])
+		if err == nil {
+			if a := Algorithm(s); a != alg {
+				return nil, fmt.Errorf("algorithm '%s' does not match decoded key of algorithm '%s'", alg, a)
+			}
+			return s, nil
+		}
+	}
+
+	if c.Legacy == nil {
+		return nil, errors.New("data is not a PKCS #8 encoded key")
+	}
+	return c.Legacy.Decode(priv, alg)
+}
+
+// Pkcs8Codec implements the Codec interface for every supported algorithm. It uses the PKCS #8,
+// ASN.1 DER encoding. secp256k1 keys are encoded as EC private keys on the secp256k1 named curve.
+type Pkcs8Codec struct{}
+
+// Encode serializes a Signer to its PKCS #8 encoding.
+func (c *Pkcs8Codec) Encode(s crypto.Signer) ([]byte, error) {
+	if k, ok := s.(*Secp256k1Signer); ok {
+		return marshalSecp256k1PKCS8(k)
+	}
+	return x509.MarshalPKCS8PrivateKey(s)
+}
+
+// Decode deserializes a PKCS #8 encoded private key to a Signer.
+func (c *Pkcs8Codec) Decode(priv []byte) (crypto.Signer, error) {
+	if k, err := parseSecp256k1PKCS8(priv); err == nil {
+		return k, nil
+	}
+
+	k, err := x509.ParsePKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := k.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("PKCS #8 key of type %T is not a signer", k)
+	}
+	return s, nil
+}
+
+// Algorithm returns the signing algorithm of s, or the empty string if it is not supported.
+func Algorithm(s crypto.Signer) string {
+	switch s.(type) {
+	case *rsa.PrivateKey:
+		return RSA
+	case *ecdsa.PrivateKey:
+		return ECDSA
+	case ed25519.PrivateKey:
+		return ED25519
+	case *Secp256k1Signer:
+		return SECP256K1
+	default:
+		return ""
+	}
+}
+
+//// secp256k1
+
+// x509 doesn't support the secp256k1 curve, so its PKCS #8 and SEC 1 structures are (un)marshaled
+// here. See RFC 5208 and RFC 5915.
+
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+func marshalSecp256k1PKCS8(k *Secp256k1Signer) ([]byte, error) {
+	params, err := asn1.Marshal(oidSecp256k1)
+	if err != nil {
+		return nil, err
+	}
+
+	pub := k.key.PubKey().SerializeUncompressed()
+	ec, err := asn1.Marshal(ecPrivateKey{
+		Version:    1,
+		PrivateKey: k.key.Serialize(),
+		PublicKey:  asn1.BitString{Bytes: pub, BitLength: 8 * len(pub)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(pkcs8{
+		Algo: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		PrivateKey: ec,
+	})
+}
+
+func parseSecp256k1PKCS8(der []byte) (*Secp256k1Signer, error) {
+	var p pkcs8
+	if _, err := asn1.Unmarshal(der, &p); err != nil {
+		return nil, err
+	}
+	if !p.Algo.Algorithm.Equal(oidPublicKeyECDSA) {
+		return nil, errors.New("PKCS #8 key is not an EC key")
+	}
+	var curve asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(p.Algo.Parameters.FullBytes, &curve); err != nil || !curve.Equal(oidSecp256k1) {
+		return nil, errors.New("PKCS #8 key is not on the secp256k1 curve")
+	}
+
+	var ec ecPrivateKey
+	if _, err := asn1.Unmarshal(p.PrivateKey, &ec); err != nil {
+		return nil, err
+	}
+	return newSecp256k1Signer(ec.PrivateKey)
+}
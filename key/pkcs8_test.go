@@ -0,0 +1,103 @@
+package key
+
+import (
+	"bytes"
+	"crypto"
+	"testing"
+)
+
+func TestPkcs8MultiCodecRoundTrip(t *testing.T) {
+	for _, alg := range []string{RSA, ECDSA, ED25519, SECP256K1} {
+		t.Run(alg, func(t *testing.T) {
+			s, err := DefaultSignerGenerator.New(alg, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			priv, err := DefaultCodec.Encode(s, alg)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if !bytes.HasPrefix(priv, pkcs8Marker) {
+				t.Fatal("Encode() didn't write the PKCS #8 marker")
+			}
+
+			got, err := DefaultCodec.Decode(priv, alg)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			assertSamePublicKey(t, got, s)
+		})
+	}
+}
+
+func TestPkcs8MultiCodecDecodeLegacy(t *testing.T) {
+	for _, alg := range []string{RSA, ECDSA, ED25519, SECP256K1} {
+		t.Run(alg, func(t *testing.T) {
+			s, err := DefaultSignerGenerator.New(alg, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			priv, err := LegacyCodec.Encode(s, alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DefaultCodec.Decode(priv, alg)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			assertSamePublicKey(t, got, s)
+		})
+	}
+}
+
+func TestPkcs8MultiCodecAlgorithmMismatch(t *testing.T) {
+	s, err := DefaultSignerGenerator.New(ED25519, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DefaultCodec.Encode(s, ECDSA); err == nil {
+		t.Error("Encode() encoded an ed25519 key as ecdsa")
+	}
+
+	priv, err := DefaultCodec.Encode(s, ED25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Pkcs8MultiCodec{}).Decode(priv, ECDSA); err == nil {
+		t.Error("Decode() decoded an ed25519 key as ecdsa")
+	}
+}
+
+func TestPkcs8MultiCodecDecodeMalformed(t *testing.T) {
+	c := &Pkcs8MultiCodec{}
+	for _, priv := range [][]byte{
+		nil,
+		[]byte("garbage"),
+		pkcs8Marker,
+		append(append([]byte{}, pkcs8Marker...), 0x30, 0x82, 0xff),
+	} {
+		if _, err := c.Decode(priv, ED25519); err == nil {
+			t.Errorf("Decode() decoded %x", priv)
+		}
+	}
+}
+
+func assertSamePublicKey(t *testing.T, got, want crypto.Signer) {
+	t.Helper()
+	type equaler interface {
+		Equal(crypto.PublicKey) bool
+	}
+	pub, ok := got.Public().(equaler)
+	if !ok {
+		// secp256k1 public keys can't be compared with Equal.
+		if !bytes.Equal(got.(*Secp256k1Signer).key.Serialize(), want.(*Secp256k1Signer).key.Serialize()) {
+			t.Fatal("decoded a different key")
+		}
+		return
+	}
+	if !pub.Equal(want.Public()) {
+		t.Fatal("decoded a different key")
+	}
+}
@@ -2,19 +2,24 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"github.com/belljustin/hancock/key"
 )
 
 func init() {
-	s := &KeyStorage{}
-	key.Register("postgres", s)
+	key.RegisterFactory("postgres", func() key.Storage {
+		return &KeyStorage{}
+	})
 }
 
 // KeyStorage is an implementation of `key.Storage` using a postgres as a backend.
@@ -22,18 +27,24 @@ type KeyStorage struct {
 	db *sql.DB
 
 	codec     key.MultiCodec
+	sealer    key.Sealer
 	generator key.SignerGenerator
 }
 
 // Open configures the `KeyStorage` using rawConfig and connects to the database.
-// If validation passes, the return value is the result of pinging the database.
+// If validation passes, the database is pinged and the secret is verified against the key check
+// value stored in the database. If it doesn't match, the error wraps `key.ErrKeyMismatch`.
 func (s *KeyStorage) Open(rawConfig []byte) error {
 	c, err := LoadConfig(rawConfig)
 	if err != nil {
 		return err
 	}
 
-	s.codec = c.GetCodec()
+	s.codec, err = c.GetCodec()
+	if err != nil {
+		return err
+	}
+	s.sealer = key.FindSealer(s.codec)
 	s.generator = key.DefaultSignerGenerator
 
 	connStr := fmt.Sprintf("user=%s password='%s' host=%s port=%d dbname=%s sslmode=%s", c.User, c.Password, c.Host, c.Port, c.Name, c.SSLMode)
@@ -43,69 +54,614 @@ func (s *KeyStorage) Open(rawConfig []byte) error {
 	}
 
 	s.db = db
-	return s.db.Ping()
+	if err := s.db.Ping(); err != nil {
+		s.db.Close()
+		return err
+	}
+
+	// A sealed secret is checked once it is unsealed.
+	if err := s.checkKey(); err != nil && !errors.Is(err, key.ErrSealed) {
+		s.db.Close()
+		return err
+	}
+	return nil
+}
+
+// Close closes the connections to the database.
+func (s *KeyStorage) Close() error {
+	return s.db.Close()
+}
+
+// SealStatus returns the status of unsealing the storage's secret. A storage without a sealed
+// secret is always unsealed.
+func (s *KeyStorage) SealStatus() key.SealStatus {
+	if s.sealer == nil {
+		return key.SealStatus{}
+	}
+	return s.sealer.SealStatus()
+}
+
+// Unseal submits a share of the storage's secret. Keys can't be fetched or created until enough
+// shares have been submitted. If the reconstructed secret doesn't match the key check value, the
+// storage is sealed again and the error wraps `key.ErrKeyMismatch`.
+func (s *KeyStorage) Unseal(share []byte) (key.SealStatus, error) {
+	if s.sealer == nil {
+		return key.SealStatus{}, errors.New("storage has no sealed secret")
+	}
+
+	status, err := s.sealer.Unseal(share)
+	if err != nil || status.Sealed {
+		return status, err
+	}
+	if err := s.checkKey(); err != nil {
+		s.sealer.Seal()
+		return s.sealer.SealStatus(), err
+	}
+	return status, nil
+}
+
+// Seal discards the storage's secret, if it has a sealed secret.
+func (s *KeyStorage) Seal() {
+	if s.sealer != nil {
+		s.sealer.Seal()
+	}
 }
 
 // Get fetches the `key.Key` specified by the unique sid from the database. All IDs MUST parse to
 // a valid uuid.
 func (s *KeyStorage) Get(sid string) (*key.Key, error) {
-	var k key.Key
-	query := `SELECT id, alg, priv FROM keys
+	return s.GetContext(context.Background(), sid)
+}
+
+// GetContext is like Get, but the queries are canceled when ctx is done. Every version of the
+// key that hasn't been destroyed is decoded.
+func (s *KeyStorage) GetContext(ctx context.Context, sid string) (*key.Key, error) {
+	query := `SELECT ` + keyColumns + ` FROM keys
 			  WHERE id = $1`
 
 	id, err := uuid.Parse(sid)
+	if err != nil {
+		return nil, fmt.Errorf("%w '%s': %v", key.ErrInvalidID, sid, err)
+	}
+
+	k, err := scanKey(s.db.QueryRowContext(ctx, query, id), sid)
 	if err != nil {
 		return nil, err
 	}
 
-	var data []byte
-	r := s.db.QueryRow(query, id)
-	if err := r.Scan(&k.ID, &k.Algorithm, &data); err != nil {
+	if k.Versions, err = s.getVersions(ctx, k); err != nil {
 		return nil, err
 	}
+	for _, v := range k.Versions {
+		if v.Version == k.Version {
+			k.Signer = v.Signer
+		}
+	}
+	if k.Signer == nil {
+		return nil, fmt.Errorf("primary version %d of key '%s' is missing", k.Version, sid)
+	}
 
-	signer, err := s.codec.Decode(data, k.Algorithm)
-	if err != nil {
+	return k, nil
+}
+
+// keyColumns are the columns read by scanKey, in order.
+const keyColumns = `id, alg, primary_version, labels, description, creator, rotation_period,
+	next_rotation_time, not_before, not_after, allowed_hashes, allowed_paddings, max_signatures,
+	signature_count, state, compromised_at, created_at, updated_at, deletion_time, destroyed_at`
+
+// scanner is implemented by `*sql.Row` and `*sql.Rows`.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanKey scans the keyColumns of a row into a `key.Key`, followed by dest. The error wraps
+// `key.ErrNotFound` if there is no row, or `key.ErrDestroyed` if the key has been destroyed.
+func scanKey(r scanner, sid string, dest ...interface{}) (*key.Key, error) {
+	var k key.Key
+	var labels []byte
+	var rotationPeriod int64
+	var nextRotationTime, notBefore, notAfter, compromisedAt, deletionTime, destroyedAt sql.NullTime
+	dest = append([]interface{}{&k.ID, &k.Algorithm, &k.Version, &labels, &k.Description, &k.Creator,
+		&rotationPeriod, &nextRotationTime, &notBefore, &notAfter, pq.Array(&k.AllowedHashes),
+		pq.Array(&k.AllowedPaddings), &k.MaxSignatures, &k.SignatureCount, &k.State, &compromisedAt,
+		&k.CreatedAt, &k.UpdatedAt, &deletionTime, &destroyedAt}, dest...)
+	if err := r.Scan(dest...); errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: '%s'", key.ErrNotFound, sid)
+	} else if err != nil {
 		return nil, err
 	}
-	k.Signer = signer
 
+	if destroyedAt.Valid {
+		return nil, fmt.Errorf("%w: '%s'", key.ErrDestroyed, sid)
+	}
+	if err := json.Unmarshal(labels, &k.Labels); err != nil {
+		return nil, err
+	}
+	k.RotationPeriod = key.Duration(rotationPeriod)
+	if nextRotationTime.Valid {
+		k.NextRotationTime = &nextRotationTime.Time
+	}
+	if notBefore.Valid {
+		k.NotBefore = &notBefore.Time
+	}
+	if notAfter.Valid {
+		k.NotAfter = &notAfter.Time
+	}
+	if compromisedAt.Valid {
+		k.CompromisedAt = &compromisedAt.Time
+	}
+	if deletionTime.Valid {
+		k.DeletionTime = &deletionTime.Time
+	}
 	return &k, nil
 }
 
+// nonNil returns values, or an empty slice if it is nil, for columns which are never NULL.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// marshalLabels encodes labels as a JSON object for the labels column. It is returned as a
+// string, since lib/pq sends []byte as bytea.
+func marshalLabels(labels map[string]string) (string, error) {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	b, err := json.Marshal(labels)
+	return string(b), err
+}
+
 // Create inserts a new `key.Key` into the database. The id will be generated as a v4 uuid.
 func (s *KeyStorage) Create(alg string, opts key.Opts) (*key.Key, error) {
-	update := `INSERT INTO keys(id, alg, priv)
-			   VALUES($1, $2, $3)`
+	return s.CreateContext(context.Background(), alg, opts, key.Metadata{})
+}
 
-	signer, err := s.generator.New(alg, opts)
+// CreateContext is like Create, but the key is described by m and the insert is canceled when
+// ctx is done. The key is created with a single version.
+func (s *KeyStorage) CreateContext(ctx context.Context, alg string, opts key.Opts, m key.Metadata) (*key.Key, error) {
+	update := `INSERT INTO keys(id, alg, primary_version, labels, description, creator, rotation_period,
+			   next_rotation_time, not_before, not_after, allowed_hashes, allowed_paddings,
+			   max_signatures, state, created_at, updated_at)
+			   VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $15)`
+
+	if err := m.ValidateFor(alg); err != nil {
+		return nil, err
+	}
+	labels, err := marshalLabels(m.Labels)
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := s.codec.Encode(signer, alg)
+	signer, err := s.generator.New(alg, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	id := uuid.New()
+	// Postgres stores timestamps with microsecond precision.
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	v := key.Version{Version: 1, CreatedAt: createdAt, Signer: signer}
+	k := &key.Key{
+		ID:        id.String(),
+		Algorithm: alg,
+		Metadata:  m,
+		State:     key.Enabled,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Version:   v.Version,
+		Versions:  []key.Version{v},
+		Signer:    signer,
+	}
+	k.ScheduleRotation(createdAt)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, update, id, alg, k.Version, labels, m.Description, m.Creator,
+		int64(m.RotationPeriod), k.NextRotationTime, m.NotBefore, m.NotAfter,
+		pq.Array(nonNil(m.AllowedHashes)), pq.Array(nonNil(m.AllowedPaddings)), m.MaxSignatures,
+		k.State, createdAt); err != nil {
+		return nil, err
+	}
+	if err := s.insertVersion(ctx, tx, id, alg, v); err != nil {
+		return nil, err
+	}
+	return k, tx.Commit()
+}
+
+// List returns a page of the keys in the database matching o, in order of creation. Private keys
+// are not read.
+func (s *KeyStorage) List(ctx context.Context, o key.ListOptions) (*key.KeyList, error) {
+	limit, err := o.GetLimit()
+	if err != nil {
+		return nil, err
+	}
+
+	where := []string{"destroyed_at IS NULL"}
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
 
-	res, err := s.db.Exec(update, id, alg, data)
+	if o.Algorithm != "" {
+		where = append(where, "alg = "+arg(o.Algorithm))
+	}
+	if !o.CreatedSince.IsZero() {
+		where = append(where, "created_at >= "+arg(o.CreatedSince))
+	}
+	if !o.CreatedBefore.IsZero() {
+		where = append(where, "created_at < "+arg(o.CreatedBefore))
+	}
+	if !o.ExpiresBefore.IsZero() {
+		where = append(where, "not_after < "+arg(o.ExpiresBefore))
+	}
+	if len(o.Labels) > 0 {
+		labels, err := marshalLabels(o.Labels)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, "labels @> "+arg(labels)+"::jsonb")
+	}
+	if o.Cursor != "" {
+		createdAt, id, err := key.DecodeCursor(o.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		cursorID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", key.ErrInvalidListOptions)
+		}
+		where = append(where, fmt.Sprintf("(created_at, id) > (%s, %s)", arg(createdAt), arg(cursorID)))
+	}
+
+	query := `SELECT ` + keyColumns + ` FROM keys
+			  WHERE ` + strings.Join(where, " AND ")
+	// One more key than the limit is read to find out whether there is a next page.
+	query += " ORDER BY created_at, id LIMIT " + arg(limit+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	l := &key.KeyList{Keys: []*key.Key{}}
+	for rows.Next() {
+		k, err := scanKey(rows, "")
+		if err != nil {
+			return nil, err
+		}
+		l.Keys = append(l.Keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(l.Keys) > limit {
+		l.Keys = l.Keys[:limit]
+		last := l.Keys[limit-1]
+		l.NextCursor = key.EncodeCursor(last.CreatedAt, last.ID)
+	}
+	return l, nil
+}
+
+// SetState transitions the key identified by sid to state.
+func (s *KeyStorage) SetState(ctx context.Context, sid string, state string) (*key.Key, error) {
+	return s.updateKey(ctx, sid, func(k *key.Key) error {
+		return k.SetState(state)
+	})
+}
+
+// ScheduleDeletion schedules the key identified by sid to be destroyed once waitingPeriod has
+// passed.
+func (s *KeyStorage) ScheduleDeletion(ctx context.Context, sid string, waitingPeriod time.Duration) (*key.Key, error) {
+	return s.updateKey(ctx, sid, func(k *key.Key) error {
+		return k.ScheduleDeletion(waitingPeriod)
+	})
+}
+
+// CancelDeletion restores the key identified by sid if it is scheduled for deletion.
+func (s *KeyStorage) CancelDeletion(ctx context.Context, sid string) (*key.Key, error) {
+	return s.updateKey(ctx, sid, func(k *key.Key) error {
+		k.DeletionTime = nil
+		return nil
+	})
+}
+
+// UpdateMetadata changes the metadata of the key identified by sid as specified by u.
+func (s *KeyStorage) UpdateMetadata(ctx context.Context, sid string, u key.MetadataUpdate) (*key.Key, error) {
+	return s.updateKey(ctx, sid, func(k *key.Key) error {
+		return k.UpdateMetadata(u, time.Now().UTC().Truncate(time.Microsecond))
+	})
+}
+
+// Purge destroys every key whose deletion time has passed. The private keys of every version are
+// overwritten, but the rows are kept so that fetching the key reports it as destroyed rather than
+// not found.
+//
+// Overwriting a row doesn't erase the ciphertext from the disk. Postgres keeps the old row version
+// until it is vacuumed, and the ciphertext remains in the WAL and in earlier backups. Purge only
+// prevents the key from being read through the storage.
+func (s *KeyStorage) Purge(ctx context.Context) (int, error) {
+	update := `UPDATE keys SET destroyed_at = now()
+			   WHERE destroyed_at IS NULL AND deletion_time <= now()`
+	updateVersions := `UPDATE key_versions SET priv = NULL, destroyed_at = now()
+					   WHERE destroyed_at IS NULL AND key_id IN (
+						   SELECT id FROM keys WHERE destroyed_at IS NOT NULL
+					   )`
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, update)
+	if err != nil {
+		return 0, err
+	}
 	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, updateVersions); err != nil {
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+// CountSignature counts a signature by the key identified by sid. Keys without a maximum number of
+// signatures aren't counted, which saves writing their row on every signature. Otherwise, the
+// count is incremented in a single statement, so concurrent signers can't exceed the maximum.
+func (s *KeyStorage) CountSignature(ctx context.Context, sid string) error {
+	query := `SELECT max_signatures FROM keys
+			  WHERE id = $1`
+	update := `UPDATE keys SET signature_count = signature_count + 1
+			   WHERE id = $1 AND destroyed_at IS NULL
+			   AND max_signatures > 0 AND signature_count < max_signatures`
+	queryKey := `SELECT ` + keyColumns + ` FROM keys
+				 WHERE id = $1`
+
+	id, err := uuid.Parse(sid)
+	if err != nil {
+		return fmt.Errorf("%w '%s': %v", key.ErrInvalidID, sid, err)
+	}
+
+	// max_signatures is 0 for keys without a limit.
+	var max int64
+	err = s.db.QueryRowContext(ctx, query, id).Scan(&max)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: '%s'", key.ErrNotFound, sid)
+	} else if err != nil || max == 0 {
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, update, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	// Nothing was counted, because the key was destroyed or is out of signatures.
+	k, err := scanKey(s.db.QueryRowContext(ctx, queryKey, id), sid)
+	if err != nil {
+		return err
+	}
+	return k.CountSignature()
+}
+
+// RefundSignature takes back a signature counted by CountSignature which wasn't made.
+func (s *KeyStorage) RefundSignature(ctx context.Context, sid string) error {
+	update := `UPDATE keys SET signature_count = signature_count - 1
+			   WHERE id = $1 AND max_signatures > 0 AND signature_count > 0`
+
+	id, err := uuid.Parse(sid)
+	if err != nil {
+		return fmt.Errorf("%w '%s': %v", key.ErrInvalidID, sid, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, update, id)
+	return err
+}
+
+// updateKey applies f to the key identified by sid in a transaction and stores its metadata,
+// rotation schedule, state and deletion time. It returns the updated key without its signer.
+func (s *KeyStorage) updateKey(ctx context.Context, sid string, f func(k *key.Key) error) (*key.Key, error) {
+	return s.updateKeyTx(ctx, sid, func(_ *sql.Tx, k *key.Key) error {
+		return f(k)
+	})
+}
+
+// updateKeyTx is like updateKey, but f is also passed the transaction, in which the key's row is
+// locked. The primary version is stored as well.
+func (s *KeyStorage) updateKeyTx(ctx context.Context, sid string, f func(tx *sql.Tx, k *key.Key) error) (*key.Key, error) {
+	query := `SELECT ` + keyColumns + ` FROM keys
+			  WHERE id = $1
+			  FOR UPDATE`
+	update := `UPDATE keys SET primary_version = $2, labels = $3, description = $4,
+			   rotation_period = $5, next_rotation_time = $6, state = $7, compromised_at = $8,
+			   deletion_time = $9, updated_at = $10
+			   WHERE id = $1`
+
+	id, err := uuid.Parse(sid)
+	if err != nil {
+		return nil, fmt.Errorf("%w '%s': %v", key.ErrInvalidID, sid, err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	if n <= 0 {
-		return nil, errors.New("No rows updated")
+	k, err := scanKey(tx.QueryRowContext(ctx, query, id), sid)
+	if err != nil {
+		return nil, err
+	}
+	if err := f(tx, k); err != nil {
+		return nil, err
 	}
 
-	return &key.Key{
-		ID:        id.String(),
-		Algorithm: alg,
-		Signer:    signer,
-	}, nil
+	labels, err := marshalLabels(k.Labels)
+	if err != nil {
+		return nil, err
+	}
+	k.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	if _, err := tx.ExecContext(ctx, update, id, k.Version, labels, k.Description,
+		int64(k.RotationPeriod), k.NextRotationTime, k.GetState(), k.CompromisedAt, k.DeletionTime,
+		k.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	k.Signer = nil
+	k.Versions = nil
+	return k, tx.Commit()
+}
+
+// Reencode rewrites the private key of every key version in the database with the current codec,
+// binding it to the version's id and algorithm. Each version is reencoded in its own transaction,
+// so Reencode may be run while the database is in use. The key check value is reencoded last.
+func (s *KeyStorage) Reencode() (int, error) {
+	n, err := s.update(func(id string, alg string, data []byte) ([]byte, bool, error) {
+		signer, err := key.DecodeKey(s.codec, id, data, alg)
+		if err != nil {
+			return nil, false, err
+		}
+		data, err = key.EncodeKey(s.codec, id, signer, alg)
+		return data, true, err
+	})
+	if err != nil {
+		return n, err
+	}
+
+	return n, s.updateKeyCheck(func(check []byte) ([]byte, bool, error) {
+		check, err := key.NewKeyCheck(s.codec)
+		return check, true, err
+	})
+}
+
+// Rewrap rewraps the data key of every key version in the database with the primary
+// key-encryption key, without decrypting the private keys. Each version is rewrapped in its own
+// transaction, so Rewrap may be run while the database is in use. The key check value is
+// rewrapped last. It requires envelope encryption.
+//
+// Versions which aren't envelope encrypted yet are skipped and reported by an error wrapping
+// `key.ErrNotEnvelope`. They are migrated by Reencode, after which Rewrap can be run again.
+func (s *KeyStorage) Rewrap() (int, error) {
+	codec, ok := s.codec.(*key.EnvelopeCodec)
+	if !ok {
+		return 0, errors.New("rewrapping requires envelope encryption")
+	}
+
+	skipped := 0
+	rewrap := func(data []byte) ([]byte, bool, error) {
+		data, changed, err := codec.Rewrap(data)
+		if errors.Is(err, key.ErrNotEnvelope) {
+			skipped++
+			return nil, false, nil
+		}
+		return data, changed, err
+	}
+
+	n, err := s.update(func(id string, alg string, data []byte) ([]byte, bool, error) {
+		return rewrap(data)
+	})
+	if err != nil {
+		return n, err
+	}
+	if err := s.updateKeyCheck(rewrap); err != nil {
+		return n, err
+	}
+
+	if skipped > 0 {
+		return n, fmt.Errorf("%w: skipped %d keys, run reencode before rewrapping them",
+			key.ErrNotEnvelope, skipped)
+	}
+	return n, nil
+}
+
+// updateFunc returns the new private key of a key version and whether it changed. The id is the
+// `key.VersionID` of the version.
+type updateFunc func(id string, alg string, data []byte) ([]byte, bool, error)
+
+// update applies f to the private key of every key version, each in its own transaction. It
+// returns the number of versions that changed.
+func (s *KeyStorage) update(f updateFunc) (int, error) {
+	rows, err := s.db.Query(`SELECT key_id, version FROM key_versions WHERE destroyed_at IS NULL`)
+	if err != nil {
+		return 0, err
+	}
+
+	type keyVersion struct {
+		id      uuid.UUID
+		version int
+	}
+	var versions []keyVersion
+	for rows.Next() {
+		var v keyVersion
+		if err := rows.Scan(&v.id, &v.version); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		versions = append(versions, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, v := range versions {
+		changed, err := s.updateRow(v.id, v.version, f)
+		if err != nil {
+			return n, fmt.Errorf("could not update version %d of key %s: %w", v.version, v.id, err)
+		}
+		if changed {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *KeyStorage) updateRow(id uuid.UUID, version int, f updateFunc) (bool, error) {
+	query := `SELECT k.alg, v.priv FROM key_versions v
+			  JOIN keys k ON k.id = v.key_id
+			  WHERE v.key_id = $1 AND v.version = $2 AND v.destroyed_at IS NULL
+			  FOR UPDATE OF v`
+	update := `UPDATE key_versions SET priv = $3
+			   WHERE key_id = $1 AND version = $2`
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var alg string
+	var data []byte
+	// The version may have been destroyed since the versions were read.
+	if err := tx.QueryRow(query, id, version).Scan(&alg, &data); errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	data, changed, err := f(key.VersionID(id.String(), version), alg, data)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	if _, err := tx.Exec(update, id, version, data); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
 }
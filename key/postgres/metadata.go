@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/belljustin/hancock/key"
+)
+
+const (
+	// keyCheckName is the name of the key check value in the metadata table.
+	keyCheckName = "key_check"
+)
+
+// checkKey verifies the codec's secret against the key check value. If the database has no key
+// check value yet, one is created with the current secret, once it has decoded a stored key.
+func (s *KeyStorage) checkKey() error {
+	query := `SELECT value FROM metadata
+			  WHERE name = $1`
+	insert := `INSERT INTO metadata(name, value)
+			   VALUES($1, $2)
+			   ON CONFLICT (name) DO NOTHING`
+
+	var check []byte
+	err := s.db.QueryRow(query, keyCheckName).Scan(&check)
+	if err == sql.ErrNoRows {
+		if err := s.checkStoredKey(); err != nil {
+			return err
+		}
+		if check, err = key.NewKeyCheck(s.codec); err != nil {
+			return err
+		}
+		if _, err := s.db.Exec(insert, keyCheckName, check); err != nil {
+			return err
+		}
+		// Another instance may have initialized the key check value concurrently.
+		err = s.db.QueryRow(query, keyCheckName).Scan(&check)
+	}
+	if err != nil {
+		return err
+	}
+
+	return key.VerifyKeyCheck(s.codec, check)
+}
+
+// checkStoredKey decodes a stored key version with the codec, so that a key check value is never
+// created from a secret which doesn't match the keys already in the database, such as when
+// upgrading a database from before key check values. It does nothing if there are no keys.
+func (s *KeyStorage) checkStoredKey() error {
+	query := `SELECT v.key_id, v.version, v.priv, k.alg FROM key_versions v
+			  JOIN keys k ON k.id = v.key_id
+			  WHERE v.destroyed_at IS NULL AND v.priv IS NOT NULL
+			  LIMIT 1`
+
+	var id uuid.UUID
+	var version int
+	var data []byte
+	var alg string
+	err := s.db.QueryRow(query).Scan(&id, &version, &data, &alg)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, err = key.DecodeKey(s.codec, key.VersionID(id.String(), version), data, alg)
+	if errors.Is(err, key.ErrSealed) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("%w: version %d of key %s can't be decoded: %v", key.ErrKeyMismatch,
+			version, id, err)
+	}
+	return nil
+}
+
+// updateKeyCheck replaces the key check value with the result of f, if it changed.
+func (s *KeyStorage) updateKeyCheck(f func(check []byte) ([]byte, bool, error)) error {
+	query := `SELECT value FROM metadata
+			  WHERE name = $1
+			  FOR UPDATE`
+	update := `UPDATE metadata SET value = $2
+			   WHERE name = $1`
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var check []byte
+	if err := tx.QueryRow(query, keyCheckName).Scan(&check); err != nil {
+		return err
+	}
+
+	check, changed, err := f(check)
+	if err != nil || !changed {
+		return err
+	}
+
+	if _, err := tx.Exec(update, keyCheckName, check); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
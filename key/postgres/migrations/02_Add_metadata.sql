@@ -0,0 +1,10 @@
+-- rambler up
+
+CREATE TABLE metadata (
+	name TEXT PRIMARY KEY,
+	value BYTEA
+);
+
+-- rambler down
+
+DROP TABLE metadata;
@@ -0,0 +1,9 @@
+-- rambler up
+
+ALTER TABLE keys ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+CREATE INDEX keys_created_at_idx ON keys (created_at, id);
+
+-- rambler down
+
+DROP INDEX keys_created_at_idx;
+ALTER TABLE keys DROP COLUMN created_at;
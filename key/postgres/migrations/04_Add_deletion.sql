@@ -0,0 +1,11 @@
+-- rambler up
+
+ALTER TABLE keys ADD COLUMN deletion_time TIMESTAMPTZ;
+ALTER TABLE keys ADD COLUMN destroyed_at TIMESTAMPTZ;
+CREATE INDEX keys_deletion_time_idx ON keys (deletion_time) WHERE destroyed_at IS NULL;
+
+-- rambler down
+
+DROP INDEX keys_deletion_time_idx;
+ALTER TABLE keys DROP COLUMN destroyed_at;
+ALTER TABLE keys DROP COLUMN deletion_time;
@@ -0,0 +1,16 @@
+-- rambler up
+
+ALTER TABLE keys ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE keys ADD COLUMN labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE keys ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE keys ADD COLUMN creator TEXT NOT NULL DEFAULT '';
+UPDATE keys SET updated_at = created_at;
+CREATE INDEX keys_labels_idx ON keys USING GIN (labels);
+
+-- rambler down
+
+DROP INDEX keys_labels_idx;
+ALTER TABLE keys DROP COLUMN creator;
+ALTER TABLE keys DROP COLUMN description;
+ALTER TABLE keys DROP COLUMN labels;
+ALTER TABLE keys DROP COLUMN updated_at;
@@ -0,0 +1,9 @@
+-- rambler up
+
+ALTER TABLE keys ADD COLUMN state TEXT NOT NULL DEFAULT 'enabled';
+ALTER TABLE keys ADD COLUMN compromised_at TIMESTAMPTZ;
+
+-- rambler down
+
+ALTER TABLE keys DROP COLUMN compromised_at;
+ALTER TABLE keys DROP COLUMN state;
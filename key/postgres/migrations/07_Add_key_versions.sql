@@ -0,0 +1,23 @@
+-- rambler up
+
+CREATE TABLE key_versions (
+	key_id UUID NOT NULL REFERENCES keys (id),
+	version INTEGER NOT NULL,
+	priv BYTEA,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	destroyed_at TIMESTAMPTZ,
+	PRIMARY KEY (key_id, version)
+);
+INSERT INTO key_versions (key_id, version, priv, created_at, destroyed_at)
+	SELECT id, 1, priv, created_at, destroyed_at FROM keys;
+ALTER TABLE keys ADD COLUMN primary_version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE keys DROP COLUMN priv;
+
+-- rambler down
+
+ALTER TABLE keys ADD COLUMN priv BYTEA;
+UPDATE keys SET priv = v.priv
+	FROM key_versions v
+	WHERE v.key_id = keys.id AND v.version = keys.primary_version;
+ALTER TABLE keys DROP COLUMN primary_version;
+DROP TABLE key_versions;
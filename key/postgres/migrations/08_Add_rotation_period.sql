@@ -0,0 +1,11 @@
+-- rambler up
+
+ALTER TABLE keys ADD COLUMN rotation_period BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE keys ADD COLUMN next_rotation_time TIMESTAMPTZ;
+CREATE INDEX keys_next_rotation_time_idx ON keys (next_rotation_time) WHERE destroyed_at IS NULL;
+
+-- rambler down
+
+DROP INDEX keys_next_rotation_time_idx;
+ALTER TABLE keys DROP COLUMN next_rotation_time;
+ALTER TABLE keys DROP COLUMN rotation_period;
@@ -0,0 +1,11 @@
+-- rambler up
+
+ALTER TABLE keys ADD COLUMN not_before TIMESTAMPTZ;
+ALTER TABLE keys ADD COLUMN not_after TIMESTAMPTZ;
+CREATE INDEX keys_not_after_idx ON keys (not_after) WHERE destroyed_at IS NULL;
+
+-- rambler down
+
+DROP INDEX keys_not_after_idx;
+ALTER TABLE keys DROP COLUMN not_after;
+ALTER TABLE keys DROP COLUMN not_before;
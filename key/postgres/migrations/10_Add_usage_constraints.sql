@@ -0,0 +1,13 @@
+-- rambler up
+
+ALTER TABLE keys ADD COLUMN allowed_hashes TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE keys ADD COLUMN allowed_paddings TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE keys ADD COLUMN max_signatures BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE keys ADD COLUMN signature_count BIGINT NOT NULL DEFAULT 0;
+
+-- rambler down
+
+ALTER TABLE keys DROP COLUMN signature_count;
+ALTER TABLE keys DROP COLUMN max_signatures;
+ALTER TABLE keys DROP COLUMN allowed_paddings;
+ALTER TABLE keys DROP COLUMN allowed_hashes;
@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/belljustin/hancock/key"
+)
+
+// getVersions fetches and decodes every version of k that hasn't been destroyed, in order.
+func (s *KeyStorage) getVersions(ctx context.Context, k *key.Key) ([]key.Version, error) {
+	query := `SELECT version, created_at, priv FROM key_versions
+			  WHERE key_id = $1 AND destroyed_at IS NULL
+			  ORDER BY version`
+
+	rows, err := s.db.QueryContext(ctx, query, k.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []key.Version
+	for rows.Next() {
+		var v key.Version
+		var data []byte
+		if err := rows.Scan(&v.Version, &v.CreatedAt, &data); err != nil {
+			return nil, err
+		}
+		if v.Signer, err = key.DecodeKey(s.codec, key.VersionID(k.ID, v.Version), data, k.Algorithm); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// insertVersion encodes v, bound to its `key.VersionID`, and inserts it into the transaction.
+func (s *KeyStorage) insertVersion(ctx context.Context, tx *sql.Tx, id uuid.UUID, alg string, v key.Version) error {
+	insert := `INSERT INTO key_versions(key_id, version, priv, created_at)
+			   VALUES($1, $2, $3, $4)`
+
+	data, err := key.EncodeKey(s.codec, key.VersionID(id.String(), v.Version), v.Signer, alg)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, insert, id, v.Version, data, v.CreatedAt)
+	return err
+}
+
+// Rotate creates a new version of the key identified by sid, like its primary version, and makes
+// it the primary version. The key's row is locked while rotating, so concurrent rotations create
+// consecutive versions.
+func (s *KeyStorage) Rotate(ctx context.Context, sid string) (*key.Key, error) {
+	return s.updateKeyTx(ctx, sid, func(tx *sql.Tx, k *key.Key) error {
+		return s.rotate(ctx, tx, k)
+	})
+}
+
+// rotationLock is the advisory lock held by the instance rotating due keys.
+const rotationLock = 0x68616e636f636b // "hancock"
+
+// errNotDue is returned when a key's rotation is no longer due once its row is locked.
+var errNotDue = errors.New("rotation is not due")
+
+// RotateDue rotates every key whose next rotation time has passed. Only one instance sharing the
+// database rotates keys at a time, which it ensures with an advisory lock. Other instances return
+// immediately. Each key is also checked to still be due once its row is locked, so a key is never
+// rotated twice for the same rotation time.
+func (s *KeyStorage) RotateDue(ctx context.Context) (int, error) {
+	lock := `SELECT pg_try_advisory_xact_lock($1)`
+	query := `SELECT id FROM keys
+			  WHERE next_rotation_time <= now() AND state = $1 AND deletion_time IS NULL
+			  AND destroyed_at IS NULL
+			  ORDER BY next_rotation_time`
+
+	// The lock is held until the transaction ends.
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, lock, rotationLock).Scan(&locked); err != nil || !locked {
+		return 0, err
+	}
+
+	rows, err := tx.QueryContext(ctx, query, key.Enabled)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	errs := make(key.RotationErrors)
+	for _, id := range ids {
+		_, err := s.updateKeyTx(ctx, id, func(tx *sql.Tx, k *key.Key) error {
+			if !k.RotationDue(time.Now()) {
+				return errNotDue
+			}
+			return s.rotate(ctx, tx, k)
+		})
+		if errors.Is(err, errNotDue) {
+			continue
+		} else if err != nil {
+			errs[id] = err
+			continue
+		}
+		n++
+	}
+	if len(errs) > 0 {
+		return n, errs
+	}
+	return n, nil
+}
+
+// rotate inserts a new version of k, like its primary version, in the transaction and makes it
+// the primary version. k's row must be locked.
+func (s *KeyStorage) rotate(ctx context.Context, tx *sql.Tx, k *key.Key) error {
+	query := `SELECT max(version) FROM key_versions
+			  WHERE key_id = $1`
+	queryPrimary := `SELECT priv FROM key_versions
+					 WHERE key_id = $1 AND version = $2`
+
+	if err := k.CheckSign(); err != nil {
+		return err
+	}
+
+	var latest int
+	if err := tx.QueryRowContext(ctx, query, k.ID).Scan(&latest); err != nil {
+		return err
+	}
+	var data []byte
+	if err := tx.QueryRowContext(ctx, queryPrimary, k.ID, k.Version).Scan(&data); err != nil {
+		return err
+	}
+	primary, err := key.DecodeKey(s.codec, key.VersionID(k.ID, k.Version), data, k.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	signer, err := s.generator.New(k.Algorithm, key.RotationOpts(primary))
+	if err != nil {
+		return err
+	}
+
+	v := key.Version{
+		Version:   latest + 1,
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+		Signer:    signer,
+	}
+	if err := s.insertVersion(ctx, tx, uuid.MustParse(k.ID), k.Algorithm, v); err != nil {
+		return err
+	}
+	k.Version = v.Version
+	k.ScheduleRotation(v.CreatedAt)
+	return nil
+}
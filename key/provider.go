@@ -0,0 +1,128 @@
+package key
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// KEKProvider supplies the secret of a key-encryption key, such as the passphrase of an
+// `AesCodec` or a KEK of a `Keyring`. Codecs request the secret whenever they need it, so
+// providers should cache secrets which are expensive to obtain.
+type KEKProvider interface {
+	// KEK returns the secret.
+	KEK() ([]byte, error)
+}
+
+// StaticKEKProvider provides a secret known in advance.
+type StaticKEKProvider []byte
+
+// KEK returns the secret.
+func (p StaticKEKProvider) KEK() ([]byte, error) {
+	return p, nil
+}
+
+// EnvKEKProvider provides the secret in an environment variable.
+type EnvKEKProvider struct {
+	// Name of the environment variable.
+	Name string
+}
+
+// KEK returns the value of the environment variable.
+func (p *EnvKEKProvider) KEK() ([]byte, error) {
+	v, ok := os.LookupEnv(p.Name)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s is not set", p.Name)
+	}
+	return []byte(v), nil
+}
+
+// FileKEKProvider provides the secret in a file, such as a credential passed by systemd. Trailing
+// whitespace is removed. The file is read once.
+type FileKEKProvider struct {
+	// Path of the file.
+	Path string
+
+	cache kekCache
+}
+
+// KEK returns the contents of the file.
+func (p *FileKEKProvider) KEK() ([]byte, error) {
+	return p.cache.get(func() ([]byte, error) {
+		b, err := ioutil.ReadFile(p.Path)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimRight(b, " \t\r\n"), nil
+	})
+}
+
+// CommandKEKProvider provides the secret printed to stdout by an external command, such as
+// `systemd-creds decrypt` or `pass show`. Trailing whitespace is removed. The command is run once.
+type CommandKEKProvider struct {
+	// Command is the name of the command followed by its arguments.
+	Command []string
+
+	cache kekCache
+}
+
+// KEK runs the command and returns its output.
+func (p *CommandKEKProvider) KEK() ([]byte, error) {
+	if len(p.Command) == 0 {
+		return nil, errors.New("command must not be empty")
+	}
+
+	return p.cache.get(func() ([]byte, error) {
+		cmd := exec.Command(p.Command[0], p.Command[1:]...)
+		cmd.Stderr = os.Stderr
+		b, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("command %s failed: %v", p.Command[0], err)
+		}
+		return bytes.TrimRight(b, " \t\r\n"), nil
+	})
+}
+
+// HexKEKProvider decodes the hex encoded secret of another `KEKProvider`.
+type HexKEKProvider struct {
+	KEKProvider
+}
+
+// KEK returns the decoded secret.
+func (p *HexKEKProvider) KEK() ([]byte, error) {
+	s, err := p.KEKProvider.KEK()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, hex.DecodedLen(len(s)))
+	if _, err := hex.Decode(b, s); err != nil {
+		return nil, fmt.Errorf("secret must be hex encoded: %v", err)
+	}
+	return b, nil
+}
+
+// kekCache caches a secret once it has been obtained successfully.
+type kekCache struct {
+	mu     sync.Mutex
+	secret []byte
+}
+
+func (c *kekCache) get(f func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.secret != nil {
+		return c.secret, nil
+	}
+
+	s, err := f()
+	if err != nil {
+		return nil, err
+	}
+	c.secret = s
+	return s, nil
+}
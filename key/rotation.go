@@ -0,0 +1,94 @@
+package key
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MinRotationPeriod is the shortest period between automatic rotations of a key.
+const MinRotationPeriod = 24 * time.Hour
+
+// Duration is a `time.Duration` encoded in JSON as a string, such as "720h".
+type Duration time.Duration
+
+// MarshalJSON encodes d as a duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a duration string, as parsed by `time.ParseDuration`.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"720h\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// ScheduleRotation sets the next rotation time of the key to a rotation period after from, or
+// clears it if the key isn't rotated automatically.
+func (k *Key) ScheduleRotation(from time.Time) {
+	if k.RotationPeriod <= 0 {
+		k.NextRotationTime = nil
+		return
+	}
+	next := from.Add(time.Duration(k.RotationPeriod))
+	k.NextRotationTime = &next
+}
+
+// RotationDue reports whether the key must be rotated automatically at now. Keys which can't sign
+// are never due.
+func (k *Key) RotationDue(now time.Time) bool {
+	return k.NextRotationTime != nil && !k.NextRotationTime.After(now) && k.CheckSign() == nil
+}
+
+// RotationErrors is returned by `Storage.RotateDue` with the error of every key that couldn't be
+// rotated, by key id. The other due keys are still rotated.
+type RotationErrors map[string]error
+
+func (e RotationErrors) Error() string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	msgs := make([]string, len(ids))
+	for i, id := range ids {
+		msgs[i] = fmt.Sprintf("could not rotate key %s: %v", id, e[id])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether the error of any key matches target.
+func (e RotationErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateMetadata changes the `Metadata` of the key as specified by u. If the rotation period
+// changes, the next rotation is scheduled a rotation period after now.
+func (k *Key) UpdateMetadata(u MetadataUpdate, now time.Time) error {
+	m, err := u.Apply(k.Metadata)
+	if err != nil {
+		return err
+	}
+	k.Metadata = m
+	if u.RotationPeriod != nil {
+		k.ScheduleRotation(now)
+	}
+	return nil
+}
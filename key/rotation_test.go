@@ -0,0 +1,26 @@
+package key
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRotationErrors(t *testing.T) {
+	err := error(RotationErrors{
+		"b": fmt.Errorf("could not decrypt: %w", ErrSealed),
+		"a": errors.New("boom"),
+	})
+
+	want := "could not rotate key a: boom; could not rotate key b: could not decrypt: " +
+		ErrSealed.Error()
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if !errors.Is(err, ErrSealed) {
+		t.Error("errors.Is() didn't find the error of a key")
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Error("errors.Is() found an error no key had")
+	}
+}
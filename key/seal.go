@@ -0,0 +1,192 @@
+package key
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/belljustin/hancock/key/shamir"
+)
+
+// SealStatus describes the progress of unsealing a `Sealer`.
+type SealStatus struct {
+	// Sealed reports whether the secret is still unavailable.
+	Sealed bool `json:"sealed"`
+	// Threshold is the number of shares required to unseal.
+	Threshold int `json:"threshold"`
+	// Progress is the number of shares submitted so far.
+	Progress int `json:"progress"`
+}
+
+// Sealer is implemented by `KEKProvider`s and `Storage`s whose secret is only available once
+// operators have submitted enough shares of it.
+type Sealer interface {
+	// SealStatus returns the current status.
+	SealStatus() SealStatus
+	// Unseal submits a share of the secret.
+	Unseal(share []byte) (SealStatus, error)
+	// Seal discards the secret and any submitted shares.
+	Seal()
+}
+
+// ShamirKEKProvider provides a secret split into shares with Shamir's secret sharing. It starts
+// sealed, returning `ErrSealed`, until threshold distinct shares have been submitted by Unseal.
+type ShamirKEKProvider struct {
+	mu        sync.Mutex
+	threshold int
+	shares    map[byte][]byte
+	secret    []byte
+}
+
+// NewShamirKEKProvider returns a sealed `ShamirKEKProvider` requiring threshold shares.
+func NewShamirKEKProvider(threshold int) (*ShamirKEKProvider, error) {
+	if threshold < 2 {
+		return nil, errors.New("threshold must be at least 2")
+	}
+	return &ShamirKEKProvider{
+		threshold: threshold,
+		shares:    make(map[byte][]byte),
+	}, nil
+}
+
+// KEK returns the secret once unsealed.
+func (p *ShamirKEKProvider) KEK() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.secret == nil {
+		return nil, ErrSealed
+	}
+	return p.secret, nil
+}
+
+// SealStatus returns the current status.
+func (p *ShamirKEKProvider) SealStatus() SealStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status()
+}
+
+func (p *ShamirKEKProvider) status() SealStatus {
+	return SealStatus{
+		Sealed:    p.secret == nil,
+		Threshold: p.threshold,
+		Progress:  len(p.shares),
+	}
+}
+
+// Unseal submits a share of the secret. Once threshold distinct shares have been submitted, the
+// secret is reconstructed and the shares are discarded.
+func (p *ShamirKEKProvider) Unseal(share []byte) (SealStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.secret != nil {
+		return p.status(), nil
+	}
+	if len(share) < 2 {
+		return p.status(), errors.New("share is too short")
+	}
+	for _, s := range p.shares {
+		if len(s) != len(share) {
+			return p.status(), fmt.Errorf("share must be %d bytes but got %d", len(s), len(share))
+		}
+		break
+	}
+	p.shares[share[len(share)-1]] = append([]byte{}, share...)
+
+	if len(p.shares) < p.threshold {
+		return p.status(), nil
+	}
+
+	shares := make([][]byte, 0, len(p.shares))
+	for _, s := range p.shares {
+		shares = append(shares, s)
+	}
+	p.shares = make(map[byte][]byte)
+	secret, err := shamir.Combine(shares)
+	if err != nil {
+		return p.status(), err
+	}
+	p.secret = secret
+	return p.status(), nil
+}
+
+// Seal discards the secret and any submitted shares.
+func (p *ShamirKEKProvider) Seal() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.secret = nil
+	p.shares = make(map[byte][]byte)
+}
+
+// FindSealer returns the `Sealer` among the `KEKProvider`s of the builtin codec c, or nil if it
+// has none. The primary KEK of a keyring is preferred, followed by the other KEKs in order of
+// their ID and then the fallback codec. Sealing it also discards the keys c derived from the
+// secret.
+func FindSealer(c MultiCodec) Sealer {
+	s := findSealer(c)
+	if s == nil {
+		return nil
+	}
+	return &codecSealer{s, c}
+}
+
+func findSealer(c MultiCodec) Sealer {
+	switch c := c.(type) {
+	case *AesCodec:
+		return providerSealer(c.provider)
+	case *EnvelopeCodec:
+		if s := providerSealer(c.keyring.KEKs[c.keyring.Primary]); s != nil {
+			return s
+		}
+		ids := make([]string, 0, len(c.keyring.KEKs))
+		for id := range c.keyring.KEKs {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			if s := providerSealer(c.keyring.KEKs[id]); s != nil {
+				return s
+			}
+		}
+		if c.Fallback != nil {
+			return findSealer(c.Fallback)
+		}
+	}
+	return nil
+}
+
+// codecSealer discards the keys derived by its codec when it is sealed, so that they can't
+// outlive the secret they were derived from.
+type codecSealer struct {
+	Sealer
+	codec MultiCodec
+}
+
+// Seal discards the secret, any submitted shares and the keys derived from the secret.
+func (s *codecSealer) Seal() {
+	s.Sealer.Seal()
+	clearKeys(s.codec)
+}
+
+func clearKeys(c MultiCodec) {
+	switch c := c.(type) {
+	case *AesCodec:
+		c.clearKeys()
+	case *EnvelopeCodec:
+		if c.Fallback != nil {
+			clearKeys(c.Fallback)
+		}
+	}
+}
+
+func providerSealer(p KEKProvider) Sealer {
+	if h, ok := p.(*HexKEKProvider); ok {
+		p = h.KEKProvider
+	}
+	if s, ok := p.(Sealer); ok {
+		return s
+	}
+	return nil
+}
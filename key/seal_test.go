@@ -0,0 +1,87 @@
+package key
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/belljustin/hancock/key/shamir"
+)
+
+// unsealAll submits every share to s and returns the final status.
+func unsealAll(t *testing.T, s Sealer, shares [][]byte) SealStatus {
+	t.Helper()
+	var status SealStatus
+	for _, share := range shares {
+		var err error
+		if status, err = s.Unseal(share); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return status
+}
+
+func TestFindSealerDiscardsDerivedKeys(t *testing.T) {
+	shares, err := shamir.Split([]byte(testPassphrase), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong, err := shamir.Split([]byte("wrong passphrase"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewShamirKEKProvider(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewAesCodecWithProvider(DefaultCodec, p, false)
+	sealer := FindSealer(c)
+	if sealer == nil {
+		t.Fatal("FindSealer() didn't find the shamir provider")
+	}
+
+	if status := unsealAll(t, sealer, shares[:2]); status.Sealed {
+		t.Fatal("Unseal() didn't unseal with the threshold of shares")
+	}
+	check, err := NewKeyCheck(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealer.Seal()
+
+	// An unseal with the wrong shares derives the wrong key, which must not be reused.
+	unsealAll(t, sealer, wrong[:2])
+	if err := VerifyKeyCheck(c, check); !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("VerifyKeyCheck() with the wrong secret = %v", err)
+	}
+	sealer.Seal()
+
+	unsealAll(t, sealer, shares[1:])
+	if err := VerifyKeyCheck(c, check); err != nil {
+		t.Fatalf("VerifyKeyCheck() after unsealing with the right shares = %v", err)
+	}
+}
+
+func TestFindSealerPrefersPrimary(t *testing.T) {
+	keks := make(map[string]KEKProvider)
+	providers := make(map[string]*ShamirKEKProvider)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		p, err := NewShamirKEKProvider(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keks[id], providers[id] = p, p
+	}
+	keks["static"] = newTestKEK(t)
+
+	for primary, want := range map[string]string{"c": "c", "static": "a"} {
+		c := NewEnvelopeCodec(DefaultCodec, newTestKeyring(t, primary, keks))
+		// Map order is random, so a lucky pick would only pass some of the time.
+		for i := 0; i < 20; i++ {
+			s, ok := FindSealer(c).(*codecSealer)
+			if !ok || s.Sealer != providers[want] {
+				t.Fatalf("FindSealer() with primary '%s' didn't return KEK '%s'", primary, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package key
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secp256k1ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+var secp256k1HalfOrder = new(big.Int).Rsh(secp256k1.S256().N, 1)
+
+// Secp256k1SignerOpts implements `crypto.SignerOpts` for `Secp256k1Signer`s. A plain crypto.Hash
+// may also be used, in which case the signature is DER encoded and S is not normalized.
+type Secp256k1SignerOpts struct {
+	// Hash is the hash function used to create the digest.
+	Hash crypto.Hash
+	// LowS normalizes S to the lower half of the curve order, as required by BIP 62 and EIP-2.
+	LowS bool
+	// Recoverable produces a 65 byte r||s||v signature instead of a DER encoding, where v is the
+	// public key recovery id (0 or 1). Recoverable signatures are always low-S.
+	Recoverable bool
+}
+
+// HashFunc returns the hash function used to create the digest.
+func (o *Secp256k1SignerOpts) HashFunc() crypto.Hash {
+	return o.Hash
+}
+
+// Secp256k1Signer implements the crypto.Signer interface for secp256k1 private keys.
+type Secp256k1Signer struct {
+	key *secp256k1.PrivateKey
+}
+
+// Public returns the public key as an *ecdsa.PublicKey on the secp256k1 curve.
+func (s *Secp256k1Signer) Public() crypto.PublicKey {
+	return s.key.PubKey().ToECDSA()
+}
+
+// Sign signs digest with the private key. If opts is a *Secp256k1SignerOpts, the signature is
+// normalized or made recoverable as requested.
+func (s *Secp256k1Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var o Secp256k1SignerOpts
+	if so, ok := opts.(*Secp256k1SignerOpts); ok {
+		o = *so
+	}
+
+	if o.Recoverable {
+		// The compact signature is v||r||s with v offset by 27.
+		compact := secp256k1ecdsa.SignCompact(s.key, digest, false)
+		sig := make([]byte, 0, len(compact))
+		sig = append(sig, compact[1:]...)
+		return append(sig, compact[0]-27), nil
+	}
+
+	r, sv, err := ecdsa.Sign(rand, s.key.ToECDSA(), digest)
+	if err != nil {
+		return nil, err
+	}
+	if o.LowS && sv.Cmp(secp256k1HalfOrder) > 0 {
+		sv.Sub(secp256k1.S256().N, sv)
+	}
+
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{r, sv})
+}
+
+func newSecp256k1Signer(priv []byte) (*Secp256k1Signer, error) {
+	if len(priv) != 32 {
+		return nil, errors.New("secp256k1 private key must be 32 bytes")
+	}
+	return &Secp256k1Signer{secp256k1.PrivKeyFromBytes(priv)}, nil
+}
@@ -0,0 +1,107 @@
+package key
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+
+	secp256k1ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+func newTestSecp256k1Key(t *testing.T) *Key {
+	t.Helper()
+	s, err := secp256k1GenerateSigner(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Key{ID: "id", Algorithm: SECP256K1, Signer: s}
+}
+
+func TestSecp256k1LowS(t *testing.T) {
+	k := newTestSecp256k1Key(t)
+	opts, err := k.SignerOpts(crypto.SHA256, SignParams{LowS: true})
+	if err != nil {
+		t.Fatalf("SignerOpts() error = %v", err)
+	}
+	if _, ok := opts.(*Secp256k1SignerOpts); !ok {
+		t.Fatalf("SignerOpts() = %T, want *Secp256k1SignerOpts", opts)
+	}
+
+	pub := k.Signer.Public().(*ecdsa.PublicKey)
+	// Half of the signatures have a high S before normalization, so these are all but certain to
+	// catch a signer that doesn't normalize.
+	for i := 0; i < 32; i++ {
+		digest := sha256.Sum256([]byte{byte(i)})
+		sig, err := k.Signer.Sign(rand.Reader, digest[:], opts)
+		if err != nil {
+			t.Fatalf("Sign() error = %v", err)
+		}
+
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+			t.Fatalf("Sign() didn't return a DER signature: %v", err)
+		}
+		if rs.S.Cmp(secp256k1HalfOrder) > 0 {
+			t.Fatalf("Sign() returned s = %v greater than n/2", rs.S)
+		}
+		if !ecdsa.Verify(pub, digest[:], rs.R, rs.S) {
+			t.Fatal("Sign() returned a signature which doesn't verify")
+		}
+	}
+}
+
+func TestSecp256k1Recoverable(t *testing.T) {
+	k := newTestSecp256k1Key(t)
+	opts, err := k.SignerOpts(crypto.SHA256, SignParams{Recoverable: true})
+	if err != nil {
+		t.Fatalf("SignerOpts() error = %v", err)
+	}
+
+	digest := sha256.Sum256([]byte("message"))
+	sig, err := k.Signer.Sign(rand.Reader, digest[:], opts)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if len(sig) != 65 {
+		t.Fatalf("Sign() returned %d bytes, want 65", len(sig))
+	}
+	if v := sig[64]; v > 1 {
+		t.Fatalf("Sign() returned recovery id %d, want 0 or 1", v)
+	}
+	if s := new(big.Int).SetBytes(sig[32:64]); s.Cmp(secp256k1HalfOrder) > 0 {
+		t.Fatalf("Sign() returned s = %v greater than n/2", s)
+	}
+
+	// RecoverCompact expects v||r||s with v offset by 27.
+	compact := append([]byte{sig[64] + 27}, sig[:64]...)
+	pub, _, err := secp256k1ecdsa.RecoverCompact(compact, digest[:])
+	if err != nil {
+		t.Fatalf("RecoverCompact() error = %v", err)
+	}
+	if !pub.ToECDSA().Equal(k.Signer.Public()) {
+		t.Fatal("RecoverCompact() recovered a different public key")
+	}
+}
+
+func TestSignerOptsSecp256k1Only(t *testing.T) {
+	k := &Key{ID: "id", Algorithm: ECDSA}
+	for _, p := range []SignParams{{LowS: true}, {Recoverable: true}} {
+		if _, err := k.SignerOpts(crypto.SHA256, p); !errors.Is(err, ErrInvalidOpts) {
+			t.Errorf("SignerOpts(%+v) error = %v, want ErrInvalidOpts", p, err)
+		}
+	}
+
+	k = newTestSecp256k1Key(t)
+	opts, err := k.SignerOpts(crypto.SHA256, SignParams{})
+	if err != nil {
+		t.Fatalf("SignerOpts() error = %v", err)
+	}
+	if opts != crypto.SHA256 {
+		t.Errorf("SignerOpts() = %v, want crypto.SHA256", opts)
+	}
+}
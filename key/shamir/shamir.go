@@ -0,0 +1,133 @@
+// Package shamir implements Shamir's secret sharing over GF(2^8)
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+var (
+	expTable [255]byte
+	logTable [256]byte
+)
+
+func init() {
+	// 0x03 generates the multiplicative group of GF(2^8) with the AES polynomial.
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		logTable[x] = byte(i)
+		x ^= xtime(x)
+	}
+}
+
+// xtime multiplies x by 0x02 modulo the AES polynomial x^8 + x^4 + x^3 + x + 1.
+func xtime(x byte) byte {
+	if x&0x80 != 0 {
+		return x<<1 ^ 0x1b
+	}
+	return x << 1
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])+int(logTable[b]))%255]
+}
+
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])-int(logTable[b])+255)%255]
+}
+
+// evaluate returns the value at x of the polynomial with the coefficients in ascending order.
+func evaluate(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// Split divides secret into the given number of parts, any threshold of which reconstruct the
+// secret with `Combine`. Each share is one byte longer than the secret.
+func Split(secret []byte, parts, threshold int) ([][]byte, error) {
+	switch {
+	case len(secret) == 0:
+		return nil, errors.New("secret must not be empty")
+	case threshold < 2:
+		return nil, errors.New("threshold must be at least 2")
+	case parts < threshold:
+		return nil, errors.New("parts must not be less than the threshold")
+	case parts > 255:
+		return nil, errors.New("parts must not exceed 255")
+	}
+
+	// Each share holds the evaluations of the polynomials at its x coordinate, followed by x.
+	shares := make([][]byte, parts)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+
+	coeffs := make([]byte, threshold)
+	for j, b := range secret {
+		coeffs[0] = b
+		if _, err := io.ReadFull(rand.Reader, coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			shares[i][j] = evaluate(coeffs, byte(i+1))
+		}
+	}
+	return shares, nil
+}
+
+// Combine reconstructs the secret from shares created by `Split`. If fewer shares than the
+// threshold are provided, the result is not the secret.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least 2 shares are required")
+	}
+
+	n := len(shares[0])
+	if n < 2 {
+		return nil, errors.New("shares are too short")
+	}
+	seen := make(map[byte]bool, len(shares))
+	for _, s := range shares {
+		if len(s) != n {
+			return nil, errors.New("shares must all be the same length")
+		}
+		x := s[n-1]
+		if x == 0 || seen[x] {
+			return nil, errors.New("shares must have distinct, non-zero x coordinates")
+		}
+		seen[x] = true
+	}
+
+	// Lagrange interpolation at 0, where subtraction is xor.
+	secret := make([]byte, n-1)
+	for i, si := range shares {
+		xi := si[n-1]
+		num, den := byte(1), byte(1)
+		for k, sk := range shares {
+			if k == i {
+				continue
+			}
+			xk := sk[n-1]
+			num = mul(num, xk)
+			den = mul(den, xi^xk)
+		}
+		basis := div(num, den)
+
+		for j := range secret {
+			secret[j] ^= mul(si[j], basis)
+		}
+	}
+	return secret, nil
+}
@@ -0,0 +1,131 @@
+package shamir
+
+import (
+	"bytes"
+	"testing"
+)
+
+var secret = []byte("a secret of several bytes \x00\xff")
+
+// subsets calls f with every subset of k of the n indices.
+func subsets(n, k int, f func([]int)) {
+	var rec func(start int, chosen []int)
+	rec = func(start int, chosen []int) {
+		if len(chosen) == k {
+			f(chosen)
+			return
+		}
+		for i := start; i < n; i++ {
+			rec(i+1, append(chosen, i))
+		}
+	}
+	rec(0, nil)
+}
+
+func pick(shares [][]byte, indices []int) [][]byte {
+	picked := make([][]byte, len(indices))
+	for i, j := range indices {
+		picked[i] = shares[j]
+	}
+	return picked
+}
+
+func TestSplitCombine(t *testing.T) {
+	for _, tc := range []struct{ parts, threshold int }{
+		{2, 2}, {3, 2}, {5, 3}, {6, 6}, {10, 4}, {255, 2},
+	} {
+		shares, err := Split(secret, tc.parts, tc.threshold)
+		if err != nil {
+			t.Fatalf("Split(%d, %d) error = %v", tc.parts, tc.threshold, err)
+		}
+		if len(shares) != tc.parts {
+			t.Fatalf("Split(%d, %d) returned %d shares", tc.parts, tc.threshold, len(shares))
+		}
+
+		got, err := Combine(shares)
+		if err != nil {
+			t.Fatalf("Combine() of all %d shares error = %v", tc.parts, err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Errorf("Combine() of all %d shares didn't recover the secret", tc.parts)
+		}
+	}
+}
+
+func TestCombineAnySubset(t *testing.T) {
+	for _, tc := range []struct{ parts, threshold int }{
+		{3, 2}, {5, 3}, {6, 4},
+	} {
+		shares, err := Split(secret, tc.parts, tc.threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k := tc.threshold; k <= tc.parts; k++ {
+			subsets(tc.parts, k, func(indices []int) {
+				got, err := Combine(pick(shares, indices))
+				if err != nil {
+					t.Fatalf("Combine(%v) error = %v", indices, err)
+				}
+				if !bytes.Equal(got, secret) {
+					t.Errorf("Combine(%v) of %d-of-%d shares didn't recover the secret", indices,
+						tc.threshold, tc.parts)
+				}
+			})
+		}
+	}
+}
+
+func TestCombineBelowThreshold(t *testing.T) {
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subsets(5, 2, func(indices []int) {
+		got, err := Combine(pick(shares, indices))
+		if err != nil {
+			t.Fatalf("Combine(%v) error = %v", indices, err)
+		}
+		if bytes.Equal(got, secret) {
+			t.Errorf("Combine(%v) recovered the secret from fewer shares than the threshold", indices)
+		}
+	})
+}
+
+func TestCombineInvalidShares(t *testing.T) {
+	shares, err := Split(secret, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero := append([]byte{}, shares[0]...)
+	zero[len(zero)-1] = 0
+
+	for name, s := range map[string][][]byte{
+		"duplicate": {shares[0], shares[0]},
+		"same x":    {shares[1], append(append([]byte{}, shares[0][:len(secret)]...), shares[1][len(secret)])},
+		"zero x":    {zero, shares[1]},
+		"one share": {shares[0]},
+		"lengths":   {shares[0], shares[1][1:]},
+		"too short": {{1}, {2}},
+		"no shares": nil,
+	} {
+		if _, err := Combine(s); err == nil {
+			t.Errorf("Combine() with %s shares succeeded", name)
+		}
+	}
+}
+
+func TestSplitInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		secret           []byte
+		parts, threshold int
+	}{
+		{nil, 3, 2},
+		{secret, 3, 1},
+		{secret, 2, 3},
+		{secret, 256, 2},
+	} {
+		if _, err := Split(tc.secret, tc.parts, tc.threshold); err == nil {
+			t.Errorf("Split(%d, %d) of %d bytes succeeded", tc.parts, tc.threshold, len(tc.secret))
+		}
+	}
+}
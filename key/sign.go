@@ -0,0 +1,101 @@
+package key
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+)
+
+const (
+	// PKCS1v15 is the RSA PKCS #1 v1.5 signature padding scheme.
+	PKCS1v15 = "pkcs1v15"
+	// PSS is the RSA probabilistic signature scheme.
+	PSS = "pss"
+)
+
+// SignParams are the options of a signature request which SignerOpts turns into
+// `crypto.SignerOpts`.
+type SignParams struct {
+	// Padding is the RSA padding scheme, which defaults to PKCS1v15.
+	Padding string
+	// SaltLength is the PSS salt length with the semantics of rsa.PSSOptions. If it is nil, the
+	// salt length equals the hash length.
+	SaltLength *int
+	// LowS and Recoverable are as in `Secp256k1SignerOpts`.
+	LowS        bool
+	Recoverable bool
+}
+
+// SignerOpts returns the `crypto.SignerOpts` for signing a digest created with hash, or for
+// signing a message with crypto.Hash(0) if the key is pure. Options which
+// don't apply to the algorithm of the key, unsupported padding schemes and salt lengths which
+// don't fit the key wrap `ErrInvalidOpts`.
+func (k *Key) SignerOpts(hash crypto.Hash, p SignParams) (crypto.SignerOpts, error) {
+	if k.Algorithm != SECP256K1 && (p.LowS || p.Recoverable) {
+		return nil, fmt.Errorf("%w: low-s and recoverable signatures are not supported by '%s' keys",
+			ErrInvalidOpts, k.Algorithm)
+	}
+	if k.Algorithm != RSA && p.Padding != "" {
+		return nil, fmt.Errorf("%w: padding '%s' is not supported by '%s' keys", ErrInvalidOpts,
+			p.Padding, k.Algorithm)
+	}
+	if p.Padding != PSS && p.SaltLength != nil {
+		return nil, fmt.Errorf("%w: salt length only applies to '%s' padding", ErrInvalidOpts, PSS)
+	}
+
+	switch k.Algorithm {
+	case RSA:
+		return k.rsaSignerOpts(hash, p)
+	case SECP256K1:
+		if p.LowS || p.Recoverable {
+			return &Secp256k1SignerOpts{Hash: hash, LowS: p.LowS, Recoverable: p.Recoverable}, nil
+		}
+		return hash, nil
+	default:
+		return hash, nil
+	}
+}
+
+func (k *Key) rsaSignerOpts(hash crypto.Hash, p SignParams) (crypto.SignerOpts, error) {
+	switch p.Padding {
+	case "", PKCS1v15:
+		return hash, nil
+	case PSS:
+		saltLength := rsa.PSSSaltLengthEqualsHash
+		if p.SaltLength != nil {
+			saltLength = *p.SaltLength
+		}
+		if err := k.checkSaltLength(hash, saltLength); err != nil {
+			return nil, err
+		}
+		return &rsa.PSSOptions{SaltLength: saltLength, Hash: hash}, nil
+	default:
+		return nil, fmt.Errorf("%w: padding '%s' is not supported", ErrInvalidOpts, p.Padding)
+	}
+}
+
+// checkSaltLength returns an error wrapping `ErrInvalidOpts` unless saltLength is
+// rsa.PSSSaltLengthAuto, rsa.PSSSaltLengthEqualsHash or a salt which fits in a PSS signature of
+// the key with hash.
+func (k *Key) checkSaltLength(hash crypto.Hash, saltLength int) error {
+	if saltLength < rsa.PSSSaltLengthEqualsHash {
+		return fmt.Errorf("%w: salt length %d is not valid", ErrInvalidOpts, saltLength)
+	}
+
+	pub, ok := k.Signer.Public().(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: key '%s' is not an rsa key", ErrInvalidOpts, k.ID)
+	}
+	max := (pub.N.BitLen()-1+7)/8 - hash.Size() - 2
+	if max < 0 {
+		return fmt.Errorf("%w: hash is too large for pss with key '%s'", ErrInvalidOpts, k.ID)
+	}
+	if saltLength == rsa.PSSSaltLengthEqualsHash {
+		saltLength = hash.Size()
+	}
+	if saltLength > max {
+		return fmt.Errorf("%w: salt length %d is longer than the maximum of %d", ErrInvalidOpts,
+			saltLength, max)
+	}
+	return nil
+}
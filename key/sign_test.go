@@ -0,0 +1,64 @@
+package key
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"testing"
+)
+
+func TestCheckSaltLength(t *testing.T) {
+	s, err := rsaGenerateSigner(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Key{ID: "id", Algorithm: RSA, Signer: s}
+	// A 2048 bit key encodes PSS signatures in 256 bytes, which leaves 256 - 32 - 2 bytes of salt
+	// with SHA-256.
+	max := 222
+
+	tests := []struct {
+		name       string
+		saltLength int
+		wantErr    bool
+	}{
+		{"equals hash", rsa.PSSSaltLengthEqualsHash, false},
+		{"auto", rsa.PSSSaltLengthAuto, false},
+		{"maximum", max, false},
+		{"past maximum", max + 1, true},
+		{"negative", -2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := k.checkSaltLength(crypto.SHA256, tt.saltLength)
+			if tt.wantErr && !errors.Is(err, ErrInvalidOpts) {
+				t.Errorf("checkSaltLength(%d) error = %v, want ErrInvalidOpts", tt.saltLength, err)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("checkSaltLength(%d) error = %v", tt.saltLength, err)
+			}
+		})
+	}
+}
+
+func TestSignerOptsPure(t *testing.T) {
+	k := &Key{ID: "id", Algorithm: ED25519, Signer: newTestSigner(t)}
+	opts, err := k.SignerOpts(crypto.Hash(0), SignParams{})
+	if err != nil {
+		t.Fatalf("SignerOpts() error = %v", err)
+	}
+	if opts != crypto.Hash(0) {
+		t.Errorf("SignerOpts() = %v, want crypto.Hash(0)", opts)
+	}
+
+	saltLength := rsa.PSSSaltLengthEqualsHash
+	for _, p := range []SignParams{
+		{Padding: PSS},
+		{Padding: PKCS1v15},
+		{SaltLength: &saltLength},
+		{LowS: true},
+	} {
+		if _, err := k.SignerOpts(crypto.Hash(0), p); !errors.Is(err, ErrInvalidOpts) {
+			t.Errorf("SignerOpts(%+v) error = %v, want ErrInvalidOpts", p, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package key
+
+import (
+	"fmt"
+	"time"
+)
+
+// Key states. New keys are enabled. Enabled keys may be disabled and enabled again, while any key
+// may be marked compromised, which can't be undone.
+const (
+	Enabled     = "enabled"
+	Disabled    = "disabled"
+	Compromised = "compromised"
+)
+
+// SetState transitions the key to state. It returns an error wrapping `ErrInvalidState` if the
+// state is unknown, or `ErrInvalidStateTransition` if the key can't transition to it. Setting
+// the current state again does nothing. Compromising a key records the time in CompromisedAt.
+func (k *Key) SetState(state string) error {
+	switch state {
+	case Enabled, Disabled, Compromised:
+	default:
+		return fmt.Errorf("%w '%s'", ErrInvalidState, state)
+	}
+
+	current := k.GetState()
+	if current == state {
+		return nil
+	}
+	if current == Compromised {
+		return fmt.Errorf("%w: key '%s' is compromised", ErrInvalidStateTransition, k.ID)
+	}
+
+	k.State = state
+	if state == Compromised {
+		compromisedAt := time.Now().UTC().Truncate(time.Microsecond)
+		k.CompromisedAt = &compromisedAt
+	}
+	return nil
+}
+
+// GetState returns the state of the key. Keys without a state are enabled.
+func (k *Key) GetState() string {
+	if k.State == "" {
+		return Enabled
+	}
+	return k.State
+}
+
+// CheckSign returns an error if the key must not be used for signing, such as while it is
+// disabled, outside of its validity period, out of signatures or pending deletion.
+func (k *Key) CheckSign() error {
+	switch k.GetState() {
+	case Disabled:
+		return fmt.Errorf("%w: '%s'", ErrDisabled, k.ID)
+	case Compromised:
+		return fmt.Errorf("%w: '%s'", ErrCompromised, k.ID)
+	}
+	if k.MaxSignatures > 0 && k.SignatureCount >= k.MaxSignatures {
+		return fmt.Errorf("%w: key '%s' has signed %d times", ErrSignatureLimit, k.ID, k.SignatureCount)
+	}
+	now := time.Now()
+	if k.NotBefore != nil && now.Before(*k.NotBefore) {
+		return fmt.Errorf("%w: key '%s' is valid from %s", ErrNotYetValid, k.ID,
+			k.NotBefore.Format(time.RFC3339))
+	}
+	if k.NotAfter != nil && now.After(*k.NotAfter) {
+		return fmt.Errorf("%w: key '%s' expired at %s", ErrExpired, k.ID, k.NotAfter.Format(time.RFC3339))
+	}
+	if k.PendingDeletion() {
+		return fmt.Errorf("%w: key '%s' will be destroyed at %s", ErrPendingDeletion, k.ID,
+			k.DeletionTime.Format(time.RFC3339))
+	}
+	return nil
+}
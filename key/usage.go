@@ -0,0 +1,51 @@
+package key
+
+import "fmt"
+
+// CheckUsage returns an error wrapping `ErrUsageNotAllowed` if the key doesn't allow signing a
+// digest of the named hash with the padding scheme. An empty padding is PKCS1v15 for RSA keys.
+// Pure keys don't sign digests, so their hash is empty and isn't checked.
+func (k *Key) CheckUsage(hash, padding string) error {
+	if hash != "" && len(k.AllowedHashes) > 0 && !contains(k.AllowedHashes, hash) {
+		return fmt.Errorf("%w: key '%s' doesn't allow hash '%s'", ErrUsageNotAllowed, k.ID, hash)
+	}
+	if k.Algorithm != RSA || len(k.AllowedPaddings) == 0 {
+		return nil
+	}
+	if padding == "" {
+		padding = PKCS1v15
+	}
+	if !contains(k.AllowedPaddings, padding) {
+		return fmt.Errorf("%w: key '%s' doesn't allow padding '%s'", ErrUsageNotAllowed, k.ID, padding)
+	}
+	return nil
+}
+
+// CountSignature counts a signature by the key. It returns an error wrapping `ErrSignatureLimit`
+// if the key has already signed its `MaxSignatures`. Keys without a maximum aren't counted.
+func (k *Key) CountSignature() error {
+	if k.MaxSignatures == 0 {
+		return nil
+	}
+	if k.SignatureCount >= k.MaxSignatures {
+		return fmt.Errorf("%w: key '%s' has signed %d times", ErrSignatureLimit, k.ID, k.SignatureCount)
+	}
+	k.SignatureCount++
+	return nil
+}
+
+// RefundSignature takes back a signature counted by CountSignature which wasn't made.
+func (k *Key) RefundSignature() {
+	if k.MaxSignatures > 0 && k.SignatureCount > 0 {
+		k.SignatureCount--
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package key
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"time"
+)
+
+// Version is a version of a `Key`. Every version has its own private key of the key's algorithm.
+type Version struct {
+	// Version numbers start at 1 and increase with every rotation.
+	Version int `json:"version" sql:"version"`
+	// CreatedAt is the time the version was created.
+	CreatedAt time.Time `json:"created_at" sql:"created_at"`
+	// Signer signs with the private key of the version.
+	Signer crypto.Signer `json:"-"`
+}
+
+// VersionID returns the id that binds the private key of a version to its key with
+// `AssociatedData`. The first version is bound to the key id itself, as keys were before they
+// had versions.
+func VersionID(id string, version int) string {
+	if version <= 1 {
+		return id
+	}
+	return fmt.Sprintf("%s/%d", id, version)
+}
+
+// RotationOpts returns the `Opts` which generate a new version like the one signing with s, such
+// as an RSA key of the same size or an ECDSA key on the same curve. RSA keys smaller than
+// `MinRSABits` are rotated to the minimum size.
+func RotationOpts(s crypto.Signer) Opts {
+	switch k := s.(type) {
+	case *rsa.PrivateKey:
+		bits := k.N.BitLen()
+		if bits < MinRSABits {
+			bits = MinRSABits
+		}
+		return Opts{"bits": bits}
+	case *ecdsa.PrivateKey:
+		return Opts{"curve": k.Curve.Params().Name}
+	}
+	return Opts{}
+}
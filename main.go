@@ -25,6 +25,7 @@ func main() {
 	app.Commands = []cli.Command{
 		client.ServerCmd,
 		client.KeyCmd,
+		client.OperatorCmd,
 	}
 
 	err := app.Run(os.Args)